@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// jwksRefreshInterval bounds how often a token signed with an unknown key
+// makes us fetch the JWKS again (Cognito rotates keys rarely).
+const jwksRefreshInterval = time.Minute
+
+// jwks holds the signing keys published at a JWKS URL, refetched when a
+// token names a key we don't have.
+type jwks struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+func newJWKS(url string) *jwks {
+	return &jwks{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// key returns the public key with the given kid.
+func (k *jwks) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(k.fetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	keys, err := k.fetch(ctx)
+	k.fetched = time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	k.keys = keys
+	if key, ok := k.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (k *jwks) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", k.url, resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, jk := range set.Keys {
+		if jk.Kty != "RSA" {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(jk.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(jk.E)
+		if err1 != nil || err2 != nil || len(e) > 8 {
+			return nil, fmt.Errorf("key %q: malformed modulus or exponent", jk.Kid)
+		}
+		keys[jk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// JWTMiddleware authenticates every request with a Cognito token: its RS256
+// signature must check out against the user pool's JWKS, it must be unexpired
+// and, when the JWKS URL is the pool's well-known one, from that pool. The
+// caller's email (which Caller resolves to a user and org) and groups come
+// from its claims. Anything else is 401.
+//
+// With AUTH_DEV_MODE=true tokens are read without checking them and a
+// request without one acts as dev@example.com. Local development only.
+func JWTMiddleware(cfg Config) gin.HandlerFunc {
+	if cfg.AuthDevMode {
+		slog.Warn("AUTH_DEV_MODE is on: tokens are not verified; never run this in production")
+		return devJWTMiddleware()
+	}
+
+	keys := newJWKS(cfg.CognitoJWKSURL)
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer, ok := strings.CutSuffix(cfg.CognitoJWKSURL, "/.well-known/jwks.json"); ok {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	parser := jwt.NewParser(opts...)
+
+	return func(c *gin.Context) {
+		raw, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || raw == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+
+		token, err := parser.Parse(raw, func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return keys.key(c.Request.Context(), kid)
+		})
+		if err != nil {
+			slog.InfoContext(c.Request.Context(), "rejected token", logging.Err(err))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			return
+		}
+
+		email, roles, err := tokenIdentity(token.Claims.(jwt.MapClaims))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set("user_email", email)
+		c.Set("roles", roles)
+		c.Next()
+	}
+}
+
+// tokenIdentity reads the caller's email and groups from verified claims.
+// The email must be present and, if the pool says so, verified.
+func tokenIdentity(claims jwt.MapClaims) (string, []string, error) {
+	email, _ := claims["email"].(string)
+	if email == "" {
+		return "", nil, errors.New("token has no email claim; use an ID token")
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return "", nil, errors.New("token's email is not verified")
+	}
+	var roles []string
+	groups, _ := claims["cognito:groups"].([]any)
+	for _, g := range groups {
+		if s, ok := g.(string); ok {
+			roles = append(roles, s)
+		}
+	}
+	return email, roles, nil
+}
+
+// devJWTMiddleware is the unverified local-dev stand-in for JWTMiddleware.
+func devJWTMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if auth == "" {
+			c.Set("user_email", "dev@example.com")
+			c.Set("roles", []string{"viewer"})
+			c.Next()
+			return
+		}
+		token, _, err := jwt.NewParser().ParseUnverified(auth, jwt.MapClaims{})
+		if err != nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		email, roles, err := tokenIdentity(token.Claims.(jwt.MapClaims))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set("user_email", email)
+		c.Set("roles", roles)
+		c.Next()
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "k1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	issuer := srv.URL
+
+	sign := func(k *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuer,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"cognito:groups": []string{"admin"},
+		}
+	}
+	with := func(k string, v any) jwt.MapClaims {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"valid token", "Bearer " + sign(key, "k1", valid()), http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"not a bearer token", "Basic YWxpY2U6cHc=", http.StatusUnauthorized},
+		{"unsigned token", "Bearer " + unsigned, http.StatusUnauthorized},
+		{"signed by another key", "Bearer " + sign(other, "k1", valid()), http.StatusUnauthorized},
+		{"unknown kid", "Bearer " + sign(key, "k2", valid()), http.StatusUnauthorized},
+		{"expired", "Bearer " + sign(key, "k1", with("exp", time.Now().Add(-time.Minute).Unix())), http.StatusUnauthorized},
+		{"no expiry", "Bearer " + sign(key, "k1", with("exp", nil)), http.StatusUnauthorized},
+		{"other issuer", "Bearer " + sign(key, "k1", with("iss", "https://evil.example.com")), http.StatusUnauthorized},
+		{"no email", "Bearer " + sign(key, "k1", with("email", nil)), http.StatusUnauthorized},
+		{"unverified email", "Bearer " + sign(key, "k1", with("email_verified", false)), http.StatusUnauthorized},
+	}
+
+	r := gin.New()
+	r.Use(JWTMiddleware(Config{CognitoJWKSURL: srv.URL + "/.well-known/jwks.json"}))
+	r.GET("/whoami", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"email": c.GetString("user_email"), "roles": c.GetStringSlice("roles")})
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusOK && w.Body.String() != `{"email":"alice@example.com","roles":["admin"]}` {
+				t.Errorf("body = %s", w.Body)
+			}
+		})
+	}
+}
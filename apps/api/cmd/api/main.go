@@ -3,48 +3,74 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 
 	handlers "github.com/your-org/aws-infra-platform/apps/api/internal/handlers"
+	"github.com/your-org/aws-infra-platform/apps/api/internal/metrics"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+	"github.com/your-org/aws-infra-platform/packages/platform/tracing"
 )
 
 func main() {
+	if _, err := logging.Setup("aip-api"); err != nil {
+		log.Fatal(err)
+	}
 	cfg := mustLoadConfig()
 
+	shutdownTracing, err := tracing.Setup(context.Background(), "aip-api")
+	if err != nil {
+		fatal("tracing setup failed", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db := mustOpenDB(cfg)
 	defer db.Close()
 
 	rdb := redis.NewClient(&redis.Options{Addr: cfg.RedisAddr})
 	defer rdb.Close()
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
-		log.Fatalf("redis: %v", err)
+		fatal("redis ping failed", err)
 	}
 
+	metrics.Register(db, rdb)
+
 	r := gin.New()
 	r.Use(gin.Recovery())
+	r.Use(otelgin.Middleware("aip-api", otelgin.WithFilter(func(req *http.Request) bool {
+		return req.URL.Path != "/healthz" && req.URL.Path != "/metrics"
+	})))
+	r.Use(metrics.Middleware())
+	r.Use(handlers.RequestLogger())
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", handlers.IdempotencyKeyHeader, handlers.RequestIDHeader, handlers.OrgIDHeader},
+		ExposeHeaders:    []string{"Content-Length", handlers.IdempotentReplayedHeader, handlers.RequestIDHeader},
 		AllowCredentials: false,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	r.GET("/healthz", func(c *gin.Context) { c.JSON(200, gin.H{"ok": true}) })
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
 	r.Use(JWTMiddleware(cfg))
 	r.GET("/whoami", func(c *gin.Context) {
@@ -55,27 +81,82 @@ func main() {
 	})
 
 	deps := &handlers.ServerDeps{
-		DB:  db,
-		RDB: rdb,
+		DB:                db,
+		RDB:               rdb,
+		IdempotencyTTL:    cfg.IdempotencyTTL,
+		PlatformPrincipal: resolvePlatformPrincipal(cfg),
+
+		AllowStaticCredentials: cfg.AllowStaticCredentials,
+		AllowWebIdentity:       cfg.AllowWebIdentity,
+		BlueprintsRoot:         cfg.BlueprintsRoot,
+		Permissions:            mustPermissionChecker(cfg),
 	}
 
-	api := r.Group("/v1")
+	go deps.RunLeaderElection(context.Background(), cfg.LeaderCheckInterval)
+	go deps.RunConnectionHealthChecks(context.Background(), cfg.ConnectionCheckInterval)
+	go deps.RunGroupDispatcher(context.Background(), cfg.GroupDispatchInterval)
+	go deps.RunDriftScheduler(context.Background(), cfg.DriftCheckInterval)
+	go deps.RunScheduler(context.Background(), cfg.SchedulerInterval)
+	go deps.RunExpiryReaper(context.Background(), cfg.ExpiryInterval, cfg.ExpiryWarning)
+	go deps.RunApprovalExpiry(context.Background(), cfg.ApprovalExpiryInterval)
+
+	api := r.Group("/v1", deps.Caller(), handlers.CallerLogger(), deps.Idempotency())
 	{
+		api.POST("/projects", deps.CreateProject)
+		api.GET("/projects", deps.ListProjects)
+		api.GET("/projects/:id", deps.GetProject)
+		api.PATCH("/projects/:id", deps.UpdateProject)
+		api.DELETE("/projects/:id", deps.DeleteProject)
+
+		api.POST("/projects/:id/environments", deps.CreateEnvironment)
+		api.GET("/projects/:id/environments", deps.ListEnvironments)
+		api.GET("/environments/:id", deps.GetEnvironment)
+		api.PATCH("/environments/:id", deps.UpdateEnvironment)
+		api.DELETE("/environments/:id", deps.DeleteEnvironment)
+
 		api.POST("/deployments", deps.CreateDeployment)
 		api.GET("/deployments", deps.ListDeployments)
+		api.GET("/deployments/:id", deps.GetDeployment)
+		api.PATCH("/deployments/:id", deps.UpdateDeployment)
+		api.GET("/deployments/:id/runs", deps.ListDeploymentRuns)
+		api.GET("/deployments/:id/resources", deps.ListDeploymentResources)
+		api.GET("/deployments/:id/outputs", deps.ListDeploymentOutputs)
 
 		api.POST("/deployments/:id/destroy", deps.DestroyDeployment)
+		api.POST("/deployments/:id/drift", deps.TriggerDriftCheck)
+		api.POST("/deployments/:id/extend", deps.ExtendDeployment)
+		api.POST("/deployments/:id/rollback", deps.RollbackDeployment)
+		api.POST("/deployments/:id/schedules", deps.CreateSchedule)
+
+		api.GET("/schedules", deps.ListSchedules)
+		api.GET("/schedules/:id", deps.GetSchedule)
+		api.POST("/schedules/:id/pause", deps.PauseSchedule)
+		api.POST("/schedules/:id/resume", deps.ResumeSchedule)
+		api.DELETE("/schedules/:id", deps.DeleteSchedule)
+		api.GET("/schedules/:id/firings", deps.ListScheduleFirings)
+
+		api.POST("/deployment-groups", deps.CreateDeploymentGroup)
+		api.GET("/deployment-groups/:id", deps.GetDeploymentGroup)
 
 		api.GET("/runs/:id", deps.GetRun)
+		api.POST("/runs/:id/approve", deps.ApproveRun)
+		api.POST("/runs/:id/reject", deps.RejectRun)
+
+		api.GET("/resources", deps.LookupResource)
 
 		api.POST("/connections/aws", deps.CreateAWSConnection)
 		api.GET("/connections/aws", deps.ListAWSConnections)
+		api.PATCH("/connections/aws/:id", deps.UpdateAWSConnection)
+		api.DELETE("/connections/aws/:id", deps.DeleteAWSConnection)
+		api.GET("/connections/aws/:id/setup", deps.GetAWSConnectionSetup)
+		api.POST("/connections/aws/:id/verify", deps.VerifyAWSConnection)
+		api.POST("/connections/aws/:id/rotate-external-id", deps.RotateAWSConnectionExternalID)
 	}
 
 	// TODO: wire handlers (connections, blueprints, deployments)
 	srv := &http.Server{Addr: ":" + cfg.Port, Handler: r}
-	log.Printf("api up on :%s", cfg.Port)
-	log.Fatal(srv.ListenAndServe())
+	slog.Info("api up", "addr", srv.Addr)
+	fatal("server stopped", srv.ListenAndServe())
 }
 
 type Config struct {
@@ -83,14 +164,100 @@ type Config struct {
 	MySQLDSN       string
 	RedisAddr      string
 	CognitoJWKSURL string
+	IdempotencyTTL time.Duration
+
+	// Skip token verification and let unauthenticated requests act as
+	// dev@example.com (AUTH_DEV_MODE=true; local development only)
+	AuthDevMode bool
+
+	// Principal written into generated trust policies; resolved from the
+	// platform credentials when empty.
+	PlatformPrincipal string
+
+	// How often connections are re-validated (0 disables)
+	ConnectionCheckInterval time.Duration
+
+	// Permit "static" credential provider connections (local testing only)
+	AllowStaticCredentials bool
+
+	// Permit "web_identity" connections (roles allowlisted per org)
+	AllowWebIdentity bool
+
+	// How often pending deployment group runs are released (0 disables)
+	GroupDispatchInterval time.Duration
+
+	// How often each applied deployment is checked for drift (0 disables)
+	DriftCheckInterval time.Duration
+
+	// How often instances contend for leadership (0: always lead; single
+	// instance only) and how often the leader fires due schedules (0 disables)
+	LeaderCheckInterval time.Duration
+	SchedulerInterval   time.Duration
+
+	// How often expired deployments are destroyed (0 disables) and how long
+	// before expiry they are flagged
+	ExpiryInterval time.Duration
+	ExpiryWarning  time.Duration
+
+	// How often applies left awaiting approval past their window are
+	// expired (0 disables)
+	ApprovalExpiryInterval time.Duration
+
+	// Where blueprint schemas (and their declared permissions) are read from
+	BlueprintsRoot string
+
+	// Pre-flight permission checks: "iam" (policy simulation), "static"
+	// (allow StaticAllowedActions; local testing) or "off"
+	PermissionChecker    string
+	StaticAllowedActions []string
 }
 
 func mustLoadConfig() Config {
 	port := getEnv("API_PORT", "8080")
 	dsn := getEnv("MYSQL_DSN", "aip:aip@tcp(127.0.0.1:3306)/aws_infra_platform?parseTime=true&multiStatements=true")
 	redis := getEnv("REDIS_ADDR", "127.0.0.1:6379")
-	jwks := os.Getenv("COGNITO_JWKS_URL") // allow empty for local/mock
-	return Config{Port: port, MySQLDSN: dsn, RedisAddr: redis, CognitoJWKSURL: jwks}
+	jwks := os.Getenv("COGNITO_JWKS_URL")
+	authDev := os.Getenv("AUTH_DEV_MODE") == "true"
+	if jwks == "" && !authDev {
+		fatal("invalid COGNITO_JWKS_URL", errors.New("required unless AUTH_DEV_MODE=true"))
+	}
+	idemTTL := getEnvDuration("IDEMPOTENCY_TTL", handlers.DefaultIdempotencyTTL)
+	principal := os.Getenv("PLATFORM_PRINCIPAL_ARN")
+	connCheck := getEnvDuration("CONNECTION_CHECK_INTERVAL", handlers.DefaultConnectionCheckInterval)
+	allowStatic := os.Getenv("ALLOW_STATIC_CREDENTIALS") == "true"
+	allowWebIdentity := os.Getenv("ALLOW_WEB_IDENTITY") == "true"
+	groupDispatch := getEnvDuration("GROUP_DISPATCH_INTERVAL", handlers.DefaultGroupDispatchInterval)
+	driftCheck := getEnvDuration("DRIFT_CHECK_INTERVAL", handlers.DefaultDriftCheckInterval)
+	leaderCheck := getEnvDuration("LEADER_CHECK_INTERVAL", handlers.DefaultLeaderCheckInterval)
+	scheduler := getEnvDuration("SCHEDULER_INTERVAL", handlers.DefaultSchedulerInterval)
+	expiry := getEnvDuration("EXPIRY_INTERVAL", handlers.DefaultExpiryInterval)
+	expiryWarning := getEnvDuration("EXPIRY_WARNING", handlers.DefaultExpiryWarning)
+	approvalExpiry := getEnvDuration("APPROVAL_EXPIRY_INTERVAL", handlers.DefaultApprovalExpiryInterval)
+	blueprints := getEnv("BLUEPRINTS_ROOT", "../../packages/blueprints")
+	checker := getEnv("PERMISSION_CHECKER", "iam")
+	staticAllowed := strings.Split(getEnv("STATIC_ALLOWED_ACTIONS", "*"), ",")
+	return Config{
+		Port:                    port,
+		MySQLDSN:                dsn,
+		RedisAddr:               redis,
+		CognitoJWKSURL:          jwks,
+		AuthDevMode:             authDev,
+		IdempotencyTTL:          idemTTL,
+		PlatformPrincipal:       principal,
+		ConnectionCheckInterval: connCheck,
+		AllowStaticCredentials:  allowStatic,
+		AllowWebIdentity:        allowWebIdentity,
+		GroupDispatchInterval:   groupDispatch,
+		DriftCheckInterval:      driftCheck,
+		LeaderCheckInterval:     leaderCheck,
+		SchedulerInterval:       scheduler,
+		ExpiryInterval:          expiry,
+		ExpiryWarning:           expiryWarning,
+		ApprovalExpiryInterval:  approvalExpiry,
+		BlueprintsRoot:          blueprints,
+		PermissionChecker:       checker,
+		StaticAllowedActions:    staticAllowed,
+	}
 }
 func getEnv(k, def string) string {
 	if v := os.Getenv(k); v != "" {
@@ -98,71 +265,75 @@ func getEnv(k, def string) string {
 	}
 	return def
 }
+func getEnvDuration(k string, def time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		fatal("invalid "+k, err)
+	}
+	return d
+}
+func mustPermissionChecker(cfg Config) handlers.PermissionChecker {
+	switch cfg.PermissionChecker {
+	case "iam":
+		return handlers.IAMPermissionChecker{}
+	case "static":
+		return handlers.StaticPermissionChecker{Allowed: cfg.StaticAllowedActions}
+	case "off":
+		slog.Warn("pre-flight permission checks disabled")
+		return nil
+	}
+	fatal("invalid PERMISSION_CHECKER", fmt.Errorf("%q: must be iam, static or off", cfg.PermissionChecker))
+	return nil
+}
+
 func mustOpenDB(cfg Config) *sql.DB {
-	db, err := sql.Open("mysql", cfg.MySQLDSN)
+	// Queries are traced as children of the request's span
+	db, err := otelsql.Open("mysql", cfg.MySQLDSN,
+		otelsql.WithAttributes(semconv.DBSystemNameMySQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 	if err != nil {
-		log.Fatal(err)
+		fatal("failed to open db", err)
 	}
 	db.SetConnMaxLifetime(time.Minute * 3)
 	db.SetMaxOpenConns(10)
 	db.SetMaxIdleConns(10)
 	if err := db.Ping(); err != nil {
-		log.Fatal(err)
+		fatal("db ping failed", err)
 	}
 	return db
 }
 
-// Lightweight JWT middleware for Cognito (accepts unsigned tokens when JWKS empty → local dev only)
-func JWTMiddleware(cfg Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		auth := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
-		if auth == "" {
-			// local dev: proceed as anonymous viewer
-			c.Set("user_email", "dev@example.com")
-			c.Set("roles", []string{"viewer"})
-			c.Next()
-			return
-		}
-		parser := jwt.Parser{}
-		token, _, err := parser.ParseUnverified(auth, jwt.MapClaims{})
-		if err != nil {
-			c.AbortWithStatus(401)
-			return
-		}
-		claims := token.Claims.(jwt.MapClaims)
-		email, _ := claims["email"].(string)
-		groupsAny, _ := claims["cognito:groups"].([]any)
-		var roles []string
-		for _, g := range groupsAny {
-			if s, ok := g.(string); ok {
-				roles = append(roles, s)
-			}
-		}
-		if email == "" {
-			email = "unknown@user"
-		}
-		c.Set("user_email", email)
-		c.Set("roles", roles)
-		c.Next()
-	}
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
 }
 
-// Example: STS AssumeRole validator (call from handler when saving AWS connection)
-func validateRole(roleArn, externalID string) error {
+// resolvePlatformPrincipal returns the principal customers should trust: the
+// configured PLATFORM_PRINCIPAL_ARN, or the root of the account our own
+// credentials belong to. If neither works it returns "", and connection setup
+// answers 503 until the API is restarted with a principal.
+func resolvePlatformPrincipal(cfg Config) string {
+	if cfg.PlatformPrincipal != "" {
+		return cfg.PlatformPrincipal
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	awsCfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		return err
-	}
-	s := sts.NewFromConfig(awsCfg)
-	_, err = s.AssumeRole(ctx, &sts.AssumeRoleInput{
-		RoleArn:         &roleArn,
-		RoleSessionName: awsString("aip-validate"),
-		ExternalId:      awsString(externalID),
-		DurationSeconds: awsInt32(900),
-	})
-	return err
+		slog.Warn("platform principal: load AWS config", logging.Err(err))
+		return ""
+	}
+	out, err := sts.NewFromConfig(awsCfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil || out.Account == nil {
+		slog.Warn("platform principal: GetCallerIdentity failed (set PLATFORM_PRINCIPAL_ARN)", logging.Err(err))
+		return ""
+	}
+	return "arn:aws:iam::" + *out.Account + ":root"
 }
-func awsString(s string) *string { return &s }
-func awsInt32(i int32) *int32    { return &i }
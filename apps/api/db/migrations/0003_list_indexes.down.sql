@@ -0,0 +1,13 @@
+-- InnoDB drops the implicit FK indexes once a composite index covers the
+-- column, so recreate them before dropping the composites.
+CREATE INDEX environment_id ON deployments (environment_id);
+CREATE INDEX created_by ON deployments (created_by);
+CREATE INDEX org_id ON aws_connections (org_id);
+
+DROP INDEX idx_deployments_env_created ON deployments;
+DROP INDEX idx_deployments_status_created ON deployments;
+DROP INDEX idx_deployments_creator_created ON deployments;
+DROP INDEX idx_deployments_created ON deployments;
+
+DROP INDEX idx_aws_connections_org_created ON aws_connections;
+DROP INDEX idx_aws_connections_org_account ON aws_connections;
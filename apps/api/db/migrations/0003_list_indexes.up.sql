@@ -0,0 +1,8 @@
+-- Keyset pagination indexes for list endpoints (sort column + id tiebreaker)
+CREATE INDEX idx_deployments_env_created ON deployments (environment_id, created_at, id);
+CREATE INDEX idx_deployments_status_created ON deployments (status, created_at, id);
+CREATE INDEX idx_deployments_creator_created ON deployments (created_by, created_at, id);
+CREATE INDEX idx_deployments_created ON deployments (created_at, id);
+
+CREATE INDEX idx_aws_connections_org_created ON aws_connections (org_id, created_at, id);
+CREATE INDEX idx_aws_connections_org_account ON aws_connections (org_id, account_id, id);
@@ -0,0 +1,5 @@
+ALTER TABLE runs
+  DROP FOREIGN KEY fk_runs_triggered_by;
+ALTER TABLE runs
+  DROP COLUMN triggered_by,
+  DROP COLUMN created_at;
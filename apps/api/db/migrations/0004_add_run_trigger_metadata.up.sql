@@ -0,0 +1,4 @@
+ALTER TABLE runs
+  ADD COLUMN triggered_by BIGINT NULL,
+  ADD COLUMN created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  ADD CONSTRAINT fk_runs_triggered_by FOREIGN KEY (triggered_by) REFERENCES users(id);
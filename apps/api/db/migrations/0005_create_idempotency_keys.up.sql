@@ -0,0 +1,17 @@
+-- Stored responses for Idempotency-Key replay on mutating endpoints
+CREATE TABLE idempotency_keys (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  org_id BIGINT NOT NULL,
+  idem_key VARCHAR(255) NOT NULL,
+  method VARCHAR(10) NOT NULL,
+  path VARCHAR(512) NOT NULL,
+  request_hash CHAR(64) NOT NULL,     -- sha256 of method + path + body
+  status_code INT NULL,               -- NULL while the first request is in flight
+  content_type VARCHAR(255) NULL,
+  response_body MEDIUMBLOB NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at TIMESTAMP NOT NULL,
+  UNIQUE KEY uniq_org_idem_key (org_id, idem_key),
+  KEY idx_idempotency_expires (expires_at),
+  FOREIGN KEY (org_id) REFERENCES orgs(id)
+);
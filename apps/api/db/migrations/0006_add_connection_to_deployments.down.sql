@@ -0,0 +1,4 @@
+ALTER TABLE deployments
+  DROP FOREIGN KEY fk_deployments_aws_connection;
+ALTER TABLE deployments
+  DROP COLUMN aws_connection_id;
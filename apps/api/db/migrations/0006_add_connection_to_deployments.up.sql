@@ -0,0 +1,4 @@
+-- Every run of a deployment resolves its AWS credentials from this connection
+ALTER TABLE deployments
+  ADD COLUMN aws_connection_id BIGINT NULL AFTER environment_id,
+  ADD CONSTRAINT fk_deployments_aws_connection FOREIGN KEY (aws_connection_id) REFERENCES aws_connections(id);
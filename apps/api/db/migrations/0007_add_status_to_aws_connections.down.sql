@@ -0,0 +1,3 @@
+ALTER TABLE aws_connections
+  DROP COLUMN status,
+  DROP COLUMN verified_at;
@@ -0,0 +1,5 @@
+-- Connections start 'pending' until the trust policy has been verified via STS.
+-- Existing rows were validated at creation, so they default to 'active'.
+ALTER TABLE aws_connections
+  ADD COLUMN status ENUM('pending','active') NOT NULL DEFAULT 'active',
+  ADD COLUMN verified_at TIMESTAMP NULL;
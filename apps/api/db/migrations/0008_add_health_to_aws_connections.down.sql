@@ -0,0 +1,8 @@
+DROP INDEX idx_aws_connections_status_checked ON aws_connections;
+
+UPDATE aws_connections SET status = 'active' WHERE status = 'failed';
+
+ALTER TABLE aws_connections
+  MODIFY COLUMN status ENUM('pending','active') NOT NULL DEFAULT 'active',
+  DROP COLUMN last_checked_at,
+  DROP COLUMN last_error;
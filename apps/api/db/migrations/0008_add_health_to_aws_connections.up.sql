@@ -0,0 +1,7 @@
+-- Periodic re-validation results; 'failed' connections block new runs
+ALTER TABLE aws_connections
+  MODIFY COLUMN status ENUM('pending','active','failed') NOT NULL DEFAULT 'active',
+  ADD COLUMN last_checked_at TIMESTAMP NULL,
+  ADD COLUMN last_error TEXT NULL;
+
+CREATE INDEX idx_aws_connections_status_checked ON aws_connections (status, last_checked_at);
@@ -0,0 +1,4 @@
+ALTER TABLE aws_connections
+  DROP COLUMN previous_external_id_expires_at,
+  DROP COLUMN previous_external_id,
+  DROP COLUMN pending_external_id;
@@ -0,0 +1,6 @@
+-- External ID rotation: a new ID waits in pending_external_id until verified,
+-- then the old one is kept as previous_external_id for an overlap window.
+ALTER TABLE aws_connections
+  ADD COLUMN pending_external_id VARCHAR(128) NULL AFTER external_id,
+  ADD COLUMN previous_external_id VARCHAR(128) NULL AFTER pending_external_id,
+  ADD COLUMN previous_external_id_expires_at TIMESTAMP NULL AFTER previous_external_id;
@@ -0,0 +1,5 @@
+ALTER TABLE aws_connections
+  DROP COLUMN sts_endpoint,
+  DROP COLUMN hub_external_id,
+  DROP COLUMN hub_role_arn,
+  DROP COLUMN credential_provider;
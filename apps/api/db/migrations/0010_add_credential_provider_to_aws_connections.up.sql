@@ -0,0 +1,8 @@
+-- How the worker obtains credentials for a connection. hub_chain assumes
+-- hub_role_arn first and the target role from there; sts_endpoint overrides
+-- the regional STS endpoint for any STS-based provider.
+ALTER TABLE aws_connections
+  ADD COLUMN credential_provider ENUM('assume_role','hub_chain','web_identity','static') NOT NULL DEFAULT 'assume_role' AFTER region,
+  ADD COLUMN hub_role_arn VARCHAR(2048) NULL AFTER credential_provider,
+  ADD COLUMN hub_external_id VARCHAR(128) NULL AFTER hub_role_arn,
+  ADD COLUMN sts_endpoint VARCHAR(512) NULL AFTER hub_external_id;
@@ -0,0 +1,17 @@
+UPDATE runs SET status = 'failed' WHERE status IN ('pending','cancelled');
+
+-- idx_runs_group_status backs fk_runs_group, so drop the FK first.
+ALTER TABLE runs
+  DROP FOREIGN KEY fk_runs_group;
+DROP INDEX idx_runs_group_status ON runs;
+ALTER TABLE runs
+  DROP COLUMN deployment_group_id,
+  MODIFY COLUMN status ENUM('queued','running','succeeded','failed') NOT NULL;
+
+ALTER TABLE deployments
+  DROP FOREIGN KEY fk_deployments_group;
+ALTER TABLE deployments
+  DROP COLUMN region,
+  DROP COLUMN deployment_group_id;
+
+DROP TABLE deployment_groups;
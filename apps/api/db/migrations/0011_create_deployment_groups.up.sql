@@ -0,0 +1,29 @@
+-- Fan-out: one request deploys a blueprint through several connections/regions.
+-- Each target gets its own deployment; group runs wait as 'pending' until the
+-- dispatcher releases them within max_concurrency.
+CREATE TABLE deployment_groups (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  environment_id BIGINT NOT NULL,
+  blueprint_id BIGINT NOT NULL,
+  action ENUM('plan','apply') NOT NULL,
+  max_concurrency INT NOT NULL DEFAULT 1,
+  failure_policy ENUM('stop','continue') NOT NULL DEFAULT 'stop',
+  created_by BIGINT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (environment_id) REFERENCES environments(id),
+  FOREIGN KEY (blueprint_id) REFERENCES blueprints(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+-- region overrides the connection's region for this deployment only
+ALTER TABLE deployments
+  ADD COLUMN deployment_group_id BIGINT NULL AFTER aws_connection_id,
+  ADD COLUMN region VARCHAR(32) NULL AFTER deployment_group_id,
+  ADD CONSTRAINT fk_deployments_group FOREIGN KEY (deployment_group_id) REFERENCES deployment_groups(id);
+
+ALTER TABLE runs
+  MODIFY COLUMN status ENUM('pending','queued','running','succeeded','failed','cancelled') NOT NULL,
+  ADD COLUMN deployment_group_id BIGINT NULL,
+  ADD CONSTRAINT fk_runs_group FOREIGN KEY (deployment_group_id) REFERENCES deployment_groups(id);
+
+CREATE INDEX idx_runs_group_status ON runs (deployment_group_id, status);
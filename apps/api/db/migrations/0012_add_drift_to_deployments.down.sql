@@ -0,0 +1,6 @@
+DROP INDEX idx_deployments_drift_checked ON deployments;
+
+ALTER TABLE deployments
+  DROP COLUMN drift_checked_at,
+  DROP COLUMN drift_details_json,
+  DROP COLUMN drifted;
@@ -0,0 +1,7 @@
+-- Result of the latest drift run (refresh + plan -detailed-exitcode)
+ALTER TABLE deployments
+  ADD COLUMN drifted BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN drift_details_json JSON NULL,
+  ADD COLUMN drift_checked_at TIMESTAMP NULL;
+
+CREATE INDEX idx_deployments_drift_checked ON deployments (drift_checked_at);
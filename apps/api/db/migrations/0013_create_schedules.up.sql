@@ -0,0 +1,33 @@
+-- Cron-style schedules that start runs on a deployment (nightly plans,
+-- drift checks, scheduled destroys). next_run_at is computed by the API from
+-- cron_expr in timezone.
+CREATE TABLE schedules (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  deployment_id BIGINT NOT NULL,
+  action ENUM('plan','apply','destroy','drift') NOT NULL,
+  cron_expr VARCHAR(128) NOT NULL,
+  timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+  paused BOOLEAN NOT NULL DEFAULT FALSE,
+  next_run_at TIMESTAMP NULL,
+  last_fired_at TIMESTAMP NULL,
+  created_by BIGINT NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (deployment_id) REFERENCES deployments(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_schedules_due ON schedules (paused, next_run_at);
+
+-- One row per firing: the run it started, or why it didn't start one.
+CREATE TABLE schedule_firings (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  schedule_id BIGINT NOT NULL,
+  scheduled_for TIMESTAMP NOT NULL,
+  fired_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  status ENUM('started','skipped','failed') NOT NULL,
+  run_id BIGINT NULL,
+  message TEXT NULL,
+  UNIQUE KEY uniq_schedule_firing (schedule_id, scheduled_for),
+  FOREIGN KEY (schedule_id) REFERENCES schedules(id) ON DELETE CASCADE,
+  FOREIGN KEY (run_id) REFERENCES runs(id)
+);
@@ -0,0 +1,11 @@
+DROP INDEX idx_deployments_expires ON deployments;
+
+ALTER TABLE deployments
+  DROP FOREIGN KEY fk_deployments_expiry_run;
+ALTER TABLE deployments
+  DROP COLUMN expiry_run_id,
+  DROP COLUMN expiry_warned_at,
+  DROP COLUMN expires_at;
+
+ALTER TABLE environments
+  DROP COLUMN default_ttl_seconds;
@@ -0,0 +1,13 @@
+-- Ephemeral deployments: expires_at is set from a per-deployment TTL or the
+-- environment's default. The leader warns ahead of expiry and then starts a
+-- destroy run, recorded in expiry_run_id.
+ALTER TABLE environments
+  ADD COLUMN default_ttl_seconds INT NULL;
+
+ALTER TABLE deployments
+  ADD COLUMN expires_at TIMESTAMP NULL,
+  ADD COLUMN expiry_warned_at TIMESTAMP NULL,
+  ADD COLUMN expiry_run_id BIGINT NULL,
+  ADD CONSTRAINT fk_deployments_expiry_run FOREIGN KEY (expiry_run_id) REFERENCES runs(id);
+
+CREATE INDEX idx_deployments_expires ON deployments (expires_at);
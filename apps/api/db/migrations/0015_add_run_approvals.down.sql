@@ -0,0 +1,14 @@
+DROP TABLE run_approvals;
+
+UPDATE runs SET status = 'failed' WHERE status = 'awaiting_approval';
+UPDATE runs SET status = 'cancelled' WHERE status IN ('rejected','expired');
+
+DROP INDEX idx_runs_status_approval ON runs;
+ALTER TABLE runs
+  DROP COLUMN approval_expires_at,
+  DROP COLUMN required_approvals,
+  MODIFY COLUMN status ENUM('pending','queued','running','succeeded','failed','cancelled') NOT NULL;
+
+ALTER TABLE environments
+  DROP COLUMN approval_ttl_seconds,
+  DROP COLUMN required_approvals;
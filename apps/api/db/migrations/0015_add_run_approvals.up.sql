@@ -0,0 +1,28 @@
+-- Approval gate for applies: on environments requiring approvals, an apply
+-- run plans first and waits as 'awaiting_approval' until enough approvers
+-- sign off ('queued' again, then applies the saved plan), someone rejects it,
+-- or approval_expires_at passes ('expired').
+ALTER TABLE environments
+  ADD COLUMN required_approvals INT NOT NULL DEFAULT 0,
+  ADD COLUMN approval_ttl_seconds INT NOT NULL DEFAULT 86400;
+
+-- required_approvals is copied from the environment when the run is enqueued
+ALTER TABLE runs
+  MODIFY COLUMN status ENUM('pending','queued','running','awaiting_approval','succeeded','failed','cancelled','rejected','expired') NOT NULL,
+  ADD COLUMN required_approvals INT NULL,
+  ADD COLUMN approval_expires_at TIMESTAMP NULL;
+
+CREATE INDEX idx_runs_status_approval ON runs (status, approval_expires_at);
+
+-- One decision per user per run
+CREATE TABLE run_approvals (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  run_id BIGINT NOT NULL,
+  user_id BIGINT NOT NULL,
+  decision ENUM('approve','reject') NOT NULL,
+  comment TEXT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_run_approval (run_id, user_id),
+  FOREIGN KEY (run_id) REFERENCES runs(id),
+  FOREIGN KEY (user_id) REFERENCES users(id)
+);
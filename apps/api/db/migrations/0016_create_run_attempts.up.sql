@@ -0,0 +1,16 @@
+-- Every attempt the worker makes at a run. Transient failures (throttling,
+-- network errors, state lock contention) are retried with backoff, so a run
+-- can have several. step is set for the steps of a gated apply, which count
+-- attempts separately.
+CREATE TABLE run_attempts (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  run_id BIGINT NOT NULL,
+  step VARCHAR(32) NOT NULL DEFAULT '',
+  attempt INT NOT NULL,
+  started_at TIMESTAMP NOT NULL,
+  finished_at TIMESTAMP NULL,
+  error TEXT NULL,
+  retryable BOOLEAN NOT NULL DEFAULT FALSE,
+  UNIQUE KEY uniq_run_attempt (run_id, step, attempt),
+  FOREIGN KEY (run_id) REFERENCES runs(id)
+);
@@ -0,0 +1,4 @@
+UPDATE runs SET status = 'failed' WHERE status = 'timed_out';
+
+ALTER TABLE runs
+  MODIFY COLUMN status ENUM('pending','queued','running','awaiting_approval','succeeded','failed','cancelled','rejected','expired') NOT NULL;
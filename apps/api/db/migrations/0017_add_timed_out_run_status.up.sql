@@ -0,0 +1,3 @@
+-- Runs whose terraform exceeded the blueprint's timeout for the action
+ALTER TABLE runs
+  MODIFY COLUMN status ENUM('pending','queued','running','awaiting_approval','succeeded','failed','timed_out','cancelled','rejected','expired') NOT NULL;
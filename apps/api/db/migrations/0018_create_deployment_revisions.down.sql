@@ -0,0 +1,8 @@
+ALTER TABLE runs
+  DROP FOREIGN KEY fk_runs_rollback_of,
+  DROP FOREIGN KEY fk_runs_revision;
+ALTER TABLE runs
+  DROP COLUMN rollback_of_run_id,
+  DROP COLUMN revision_id;
+
+DROP TABLE deployment_revisions;
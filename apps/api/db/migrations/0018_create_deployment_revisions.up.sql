@@ -0,0 +1,33 @@
+-- Every blueprint version + inputs a deployment has been given. deployments
+-- keeps the current values; each run records the revision it deployed so an
+-- earlier one can be restored (rollback).
+CREATE TABLE deployment_revisions (
+  id BIGINT PRIMARY KEY AUTO_INCREMENT,
+  deployment_id BIGINT NOT NULL,
+  revision INT NOT NULL,
+  blueprint_id BIGINT NOT NULL,
+  inputs_json JSON NOT NULL,
+  source ENUM('create','update','rollback') NOT NULL,
+  created_by BIGINT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_deployment_revision (deployment_id, revision),
+  FOREIGN KEY (deployment_id) REFERENCES deployments(id),
+  FOREIGN KEY (blueprint_id) REFERENCES blueprints(id),
+  FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+-- rollback_of_run_id: the earlier apply whose revision a rollback run restores
+ALTER TABLE runs
+  ADD COLUMN revision_id BIGINT NULL,
+  ADD COLUMN rollback_of_run_id BIGINT NULL,
+  ADD CONSTRAINT fk_runs_revision FOREIGN KEY (revision_id) REFERENCES deployment_revisions(id),
+  ADD CONSTRAINT fk_runs_rollback_of FOREIGN KEY (rollback_of_run_id) REFERENCES runs(id);
+
+-- Existing deployments start with their current values as revision 1
+INSERT INTO deployment_revisions (deployment_id, revision, blueprint_id, inputs_json, source, created_by, created_at)
+SELECT id, 1, blueprint_id, inputs_json, 'create', created_by, created_at
+FROM deployments;
+
+UPDATE runs r
+JOIN deployment_revisions rev ON rev.deployment_id = r.deployment_id
+SET r.revision_id = rev.id;
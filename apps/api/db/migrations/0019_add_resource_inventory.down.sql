@@ -0,0 +1,7 @@
+ALTER TABLE resources
+  DROP FOREIGN KEY fk_resources_last_run;
+ALTER TABLE resources
+  DROP KEY idx_resources_arn,
+  DROP COLUMN updated_at,
+  DROP COLUMN last_run_id,
+  DROP COLUMN address;
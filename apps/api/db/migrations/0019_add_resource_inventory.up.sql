@@ -0,0 +1,9 @@
+-- The worker syncs resources from terraform state after every apply and
+-- destroy. address is the resource's terraform address; the arn index serves
+-- lookups of which deployment owns a resource.
+ALTER TABLE resources
+  ADD COLUMN address VARCHAR(512) NOT NULL DEFAULT '' AFTER arn,
+  ADD COLUMN last_run_id BIGINT NULL,
+  ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  ADD KEY idx_resources_arn (arn(255)),
+  ADD CONSTRAINT fk_resources_last_run FOREIGN KEY (last_run_id) REFERENCES runs(id);
@@ -0,0 +1,7 @@
+ALTER TABLE deployments
+  DROP FOREIGN KEY fk_deployments_outputs_run;
+ALTER TABLE deployments
+  DROP COLUMN outputs_run_id;
+
+ALTER TABLE runs
+  DROP COLUMN outputs_json;
@@ -0,0 +1,20 @@
+-- Outputs are captured after every successful apply and cleared by a
+-- successful destroy. Each of those runs keeps a snapshot of the outputs it
+-- produced (an empty object for a destroy); outputs_run_id is the run the
+-- deployment's current outputs came from.
+ALTER TABLE runs
+  ADD COLUMN outputs_json JSON NULL;
+
+ALTER TABLE deployments
+  ADD COLUMN outputs_run_id BIGINT NULL,
+  ADD CONSTRAINT fk_deployments_outputs_run FOREIGN KEY (outputs_run_id) REFERENCES runs(id);
+
+-- Destroys used to record the outputs they left behind
+UPDATE deployments dep
+SET dep.outputs_json = NULL
+WHERE (
+  SELECT r.action FROM runs r
+  WHERE r.deployment_id = dep.id AND r.status = 'succeeded' AND r.action IN ('apply', 'destroy')
+  ORDER BY r.id DESC
+  LIMIT 1
+) = 'destroy';
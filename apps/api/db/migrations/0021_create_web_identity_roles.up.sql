@@ -0,0 +1,11 @@
+-- Roles an org may connect with the web_identity provider. Those roles trust
+-- the worker's OIDC identity rather than an org-specific external ID, so
+-- without this list any org could name any of them. Maintained by platform
+-- operators.
+CREATE TABLE web_identity_roles (
+  org_id BIGINT NOT NULL,
+  role_arn VARCHAR(512) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (org_id, role_arn),
+  FOREIGN KEY (org_id) REFERENCES orgs(id)
+);
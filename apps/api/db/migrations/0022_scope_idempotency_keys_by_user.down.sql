@@ -0,0 +1,7 @@
+DELETE FROM idempotency_keys;
+ALTER TABLE idempotency_keys
+  ADD UNIQUE KEY uniq_org_idem_key (org_id, idem_key);
+ALTER TABLE idempotency_keys
+  DROP FOREIGN KEY fk_idempotency_keys_user,
+  DROP KEY uniq_org_user_idem_key,
+  DROP COLUMN user_id;
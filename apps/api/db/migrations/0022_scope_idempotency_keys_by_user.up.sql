@@ -0,0 +1,11 @@
+-- Idempotency keys are scoped to the user who sent them, so members of an
+-- org can't replay (or block) each other's requests by picking the same key.
+-- Existing keys can't be attributed to a user; they are dropped (they expire
+-- within IDEMPOTENCY_TTL anyway).
+DELETE FROM idempotency_keys;
+ALTER TABLE idempotency_keys
+  ADD COLUMN user_id BIGINT NOT NULL AFTER org_id,
+  ADD UNIQUE KEY uniq_org_user_idem_key (org_id, user_id, idem_key),
+  ADD CONSTRAINT fk_idempotency_keys_user FOREIGN KEY (user_id) REFERENCES users(id);
+ALTER TABLE idempotency_keys
+  DROP KEY uniq_org_idem_key;
@@ -0,0 +1,5 @@
+ALTER TABLE resources
+  ADD UNIQUE KEY uniq_deployment_arn (deployment_id, arn(255));
+ALTER TABLE resources
+  DROP KEY uniq_deployment_arn_hash,
+  DROP COLUMN arn_hash;
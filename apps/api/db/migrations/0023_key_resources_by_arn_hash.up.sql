@@ -0,0 +1,8 @@
+-- Resources were unique on the first 255 characters of their ARN, so ARNs
+-- sharing that prefix overwrote each other in the worker's upsert. Key them
+-- on a hash of the whole ARN instead.
+ALTER TABLE resources
+  ADD COLUMN arn_hash BINARY(32) AS (UNHEX(SHA2(arn, 256))) STORED AFTER arn,
+  ADD UNIQUE KEY uniq_deployment_arn_hash (deployment_id, arn_hash);
+ALTER TABLE resources
+  DROP KEY uniq_deployment_arn;
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+const (
+	// DefaultApprovalTTL is how long a planned apply waits for approval on
+	// environments that don't set their own window.
+	DefaultApprovalTTL = 24 * time.Hour
+
+	// DefaultApprovalExpiryInterval is how often the leader expires applies
+	// whose approval window has passed.
+	DefaultApprovalExpiryInterval = time.Minute
+
+	maxRequiredApprovals = 10
+	minApprovalTTL       = 5 * time.Minute
+)
+
+// Membership roles allowed to approve or reject applies.
+var approverRoles = []string{"admin", "maintainer"}
+
+// validApprovalTTL checks an approval window given in seconds. It can't
+// outlive the saved plan.
+func validApprovalTTL(seconds int64) error {
+	ttl := time.Duration(seconds) * time.Second
+	if ttl < minApprovalTTL || ttl > jobs.MaxPlanAge {
+		return fmt.Errorf("approvalTtlSeconds must be between %d and %d",
+			int64(minApprovalTTL/time.Second), int64(jobs.MaxPlanAge/time.Second))
+	}
+	return nil
+}
+
+// gateApply copies the approvals required by the run's environment onto the
+// run and returns them. Later changes to the environment don't affect runs
+// already under way.
+func (d *ServerDeps) gateApply(ctx context.Context, runID int64) (int, error) {
+	if _, err := d.DB.ExecContext(ctx, `
+		UPDATE runs r
+		JOIN deployments dep ON dep.id = r.deployment_id
+		JOIN environments e ON e.id = dep.environment_id
+		SET r.required_approvals = e.required_approvals
+		WHERE r.id = ? AND r.required_approvals IS NULL
+	`, runID); err != nil {
+		return 0, err
+	}
+
+	var required int
+	err := d.DB.QueryRowContext(ctx,
+		`SELECT COALESCE(required_approvals, 0) FROM runs WHERE id = ?`, runID,
+	).Scan(&required)
+	return required, err
+}
+
+// RunApproval is one approver's decision on a run.
+type RunApproval struct {
+	User      UserRef   `json:"user"`
+	Decision  string    `json:"decision"` // "approve" or "reject"
+	Comment   *string   `json:"comment,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RunDecisionReq struct {
+	Comment string `json:"comment"`
+}
+
+// POST /v1/runs/:id/approve
+// Records the caller's approval of an apply awaiting approval; the run's
+// author can't approve it. Once the environment's required number of
+// distinct approvers is reached, the saved plan is queued for apply.
+func (d *ServerDeps) ApproveRun(c *gin.Context) {
+	d.decideRun(c, "approve")
+}
+
+// POST /v1/runs/:id/reject
+// Rejects an apply awaiting approval; its saved plan is discarded.
+func (d *ServerDeps) RejectRun(c *gin.Context) {
+	d.decideRun(c, "reject")
+}
+
+func (d *ServerDeps) decideRun(c *gin.Context, decision string) {
+	runID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid run id"})
+		return
+	}
+
+	// The body is optional
+	var req RunDecisionReq
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	orgID := callerOrgID(c)
+	userID := callerUserID(c)
+
+	allowed, err := d.isApprover(ctx, userID, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load membership"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only org admins and maintainers can approve or reject applies"})
+		return
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		deploymentID int64
+		status       string
+		required     sql.NullInt64
+		expiresAt    sql.NullTime
+		triggeredBy  sql.NullInt64
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT r.deployment_id, r.status, r.required_approvals, r.approval_expires_at, r.triggered_by
+		FROM runs r
+		JOIN deployments dep ON dep.id = r.deployment_id
+		JOIN environments env ON env.id = dep.environment_id
+		JOIN projects p ON p.id = env.project_id
+		WHERE r.id = ? AND p.org_id = ?
+		FOR UPDATE
+	`, runID, orgID).Scan(&deploymentID, &status, &required, &expiresAt, &triggeredBy)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load run"})
+		return
+	}
+	if status != "awaiting_approval" {
+		c.JSON(http.StatusConflict, gin.H{"error": "run is " + status + ", not awaiting approval"})
+		return
+	}
+	if expiresAt.Valid && !expiresAt.Time.After(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{"error": "approval window has passed"})
+		return
+	}
+	// Authors may withdraw (reject) their own apply, but not sign it off
+	if decision == "approve" && triggeredBy.Valid && triggeredBy.Int64 == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "you can't approve a run you started"})
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO run_approvals (run_id, user_id, decision, comment)
+		VALUES (?, ?, ?, NULLIF(?, ''))
+	`, runID, userID, decision, req.Comment); err != nil {
+		if isDuplicateKey(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "you have already decided on this run"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record decision: " + err.Error()})
+		return
+	}
+
+	if decision == "reject" {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE runs SET status = 'rejected', finished_at = NOW() WHERE id = ?`, runID,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reject run: " + err.Error()})
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit transaction"})
+			return
+		}
+		d.discardPlan(ctx, runID)
+
+		c.JSON(http.StatusOK, gin.H{"runId": runID, "status": "rejected"})
+		return
+	}
+
+	var approvals int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM run_approvals WHERE run_id = ? AND decision = 'approve'`, runID,
+	).Scan(&approvals); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count approvals"})
+		return
+	}
+
+	resp := gin.H{
+		"runId":             runID,
+		"status":            status,
+		"approvals":         approvals,
+		"requiredApprovals": required.Int64,
+	}
+	if int64(approvals) < required.Int64 {
+		if err := tx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit transaction"})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	// Approved: queue the apply of the saved plan
+	job, conn, err := runJob(ctx, tx, runID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is not bound to an AWS connection"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve deployment: " + err.Error()})
+		return
+	}
+	if !conn.usable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection is " + conn.Status + "; re-verify it (POST /v1/connections/aws/:id/verify) before approving"})
+		return
+	}
+	job.Step = jobs.StepApplyPlan
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE runs SET status = 'queued' WHERE id = ?`, runID,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue run: " + err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit transaction"})
+		return
+	}
+
+	if err := d.enqueueJob(context.WithoutCancel(ctx), job); err != nil {
+		if _, err2 := d.DB.ExecContext(context.Background(), `
+			UPDATE runs SET status = 'failed', summary = ?, finished_at = NOW() WHERE id = ?
+		`, "not started: "+err.Error(), runID); err2 != nil {
+			slog.ErrorContext(logging.WithRun(ctx, runID), "mark run failed", logging.Err(err2))
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue job: " + err.Error()})
+		return
+	}
+
+	resp["status"] = "queued"
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// isApprover reports whether the user may approve applies in the org.
+func (d *ServerDeps) isApprover(ctx context.Context, userID, orgID int64) (bool, error) {
+	var role string
+	err := d.DB.QueryRowContext(ctx,
+		`SELECT role FROM memberships WHERE user_id = ? AND org_id = ?`, userID, orgID,
+	).Scan(&role)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, r := range approverRoles {
+		if role == r {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// discardPlan drops a run's saved plan; best effort, as it expires anyway.
+func (d *ServerDeps) discardPlan(ctx context.Context, runID int64) {
+	if err := d.RDB.Del(ctx, jobs.PlanKey(runID)).Err(); err != nil {
+		slog.WarnContext(logging.WithRun(ctx, runID), "discard saved plan", logging.Err(err))
+	}
+}
+
+// loadRunApprovals returns the decisions recorded on a run, oldest first.
+func (d *ServerDeps) loadRunApprovals(ctx context.Context, runID int64) ([]RunApproval, error) {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT u.id, u.email, a.decision, a.comment, a.created_at
+		FROM run_approvals a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.run_id = ?
+		ORDER BY a.id
+	`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []RunApproval{}
+	for rows.Next() {
+		var (
+			a       RunApproval
+			comment sql.NullString
+		)
+		if err := rows.Scan(&a.User.ID, &a.User.Email, &a.Decision, &comment, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if comment.Valid {
+			s := comment.String
+			a.Comment = &s
+		}
+		approvals = append(approvals, a)
+	}
+	return approvals, rows.Err()
+}
+
+// RunApprovalExpiry marks applies still awaiting approval past their window
+// as expired, every interval until ctx is cancelled. Only the leader acts.
+func (d *ServerDeps) RunApprovalExpiry(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.InfoContext(ctx, "approval expiry disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if d.isLeader() {
+			d.expireApprovals(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *ServerDeps) expireApprovals(ctx context.Context) {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT id FROM runs
+		WHERE status = 'awaiting_approval' AND approval_expires_at <= NOW()
+	`)
+	if err != nil {
+		slog.ErrorContext(ctx, "approval expiry: query runs", logging.Err(err))
+		return
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			slog.ErrorContext(ctx, "approval expiry: scan run", logging.Err(err))
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "approval expiry: rows error", logging.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		rctx := logging.WithRun(ctx, id)
+		res, err := d.DB.ExecContext(ctx, `
+			UPDATE runs
+			SET status = 'expired',
+			    finished_at = NOW()
+			WHERE id = ? AND status = 'awaiting_approval'
+		`, id)
+		if err != nil {
+			slog.ErrorContext(rctx, "expire approval", logging.Err(err))
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // decided meanwhile
+		}
+		d.discardPlan(ctx, id)
+		slog.InfoContext(rctx, "approval window passed; apply expired")
+	}
+}
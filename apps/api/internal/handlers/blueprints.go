@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+// blueprintSchema is the part of a blueprint's schema.yaml the API reads.
+type blueprintSchema struct {
+	Inputs      map[string]inputSpec    `yaml:"inputs"`
+	Permissions map[string][]Permission `yaml:"permissions"`
+
+	// How long each action's terraform may run, as Go durations ("30m")
+	Timeouts map[string]string `yaml:"timeouts"`
+}
+
+// loadBlueprintSchema reads <BlueprintsRoot>/<key>/<version>/schema.yaml. It
+// returns nil if the blueprint has no schema.
+func (d *ServerDeps) loadBlueprintSchema(key, version string) (*blueprintSchema, error) {
+	if d.BlueprintsRoot == "" {
+		return nil, nil
+	}
+
+	raw, err := os.ReadFile(filepath.Join(d.BlueprintsRoot, key, version, "schema.yaml"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var schema blueprintSchema
+	if err := yaml.Unmarshal(raw, &schema); err != nil {
+		return nil, fmt.Errorf("%s@%s schema: %w", key, version, err)
+	}
+	return &schema, nil
+}
+
+// blueprintTimeout returns the timeout a blueprint declares for a job, or 0
+// to leave it to the worker. The plan step of a gated apply and drift runs
+// use plan's.
+func (d *ServerDeps) blueprintTimeout(job jobs.Job) (time.Duration, error) {
+	schema, err := d.loadBlueprintSchema(job.BlueprintKey, job.Version)
+	if err != nil || schema == nil {
+		return 0, err
+	}
+
+	action := job.Action
+	if action == jobs.ActionDrift || job.Step == jobs.StepPlanForApproval {
+		action = jobs.ActionPlan
+	}
+	v, ok := schema.Timeouts[action]
+	if !ok {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("%s@%s schema: invalid %s timeout %q", job.BlueprintKey, job.Version, action, v)
+	}
+	return timeout, nil
+}
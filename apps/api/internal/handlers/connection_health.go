@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// DefaultConnectionCheckInterval is how often every connection is re-validated.
+const DefaultConnectionCheckInterval = 15 * time.Minute
+
+// roleRejectedCodes are the STS/IAM error codes that mean the role itself
+// refuses us (or is gone), as opposed to throttling, network trouble or a
+// timeout, which say nothing about the connection.
+var roleRejectedCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccessDeniedException": true,
+	"NoSuchEntity":          true,
+	"NoSuchEntityException": true,
+}
+
+// roleRejected reports whether err is a definitive refusal from AWS.
+func roleRejected(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && roleRejectedCodes[apiErr.ErrorCode()]
+}
+
+// checkConnection runs the STS check for conn and records the outcome:
+// success (re)activates it; a definitive refusal (see roleRejected) marks an
+// active connection 'failed'. Other errors are recorded in last_error but
+// leave the status alone, so a blip doesn't block runs until the next check.
+// Pending connections stay pending until their first successful check.
+func (d *ServerDeps) checkConnection(ctx context.Context, conn *awsConnection) error {
+	checkErr := d.verifyRole(ctx, conn, conn.ExternalID)
+
+	// Persist even if the caller's context is gone.
+	sctx, cancel := contextWithTimeout(5 * time.Second)
+	defer cancel()
+
+	var err error
+	if checkErr == nil {
+		_, err = d.DB.ExecContext(sctx, `
+			UPDATE aws_connections
+			SET status = 'active',
+			    verified_at = NOW(),
+			    last_checked_at = NOW(),
+			    last_error = NULL
+			WHERE id = ?
+		`, conn.ID)
+	} else if roleRejected(checkErr) {
+		_, err = d.DB.ExecContext(sctx, `
+			UPDATE aws_connections
+			SET status = IF(status = 'pending', 'pending', 'failed'),
+			    last_checked_at = NOW(),
+			    last_error = ?
+			WHERE id = ?
+		`, checkErr.Error(), conn.ID)
+	} else {
+		_, err = d.DB.ExecContext(sctx, `
+			UPDATE aws_connections
+			SET last_checked_at = NOW(),
+			    last_error = ?
+			WHERE id = ?
+		`, checkErr.Error(), conn.ID)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record connection health check", "connection_id", conn.ID, logging.Err(err))
+	}
+
+	return checkErr
+}
+
+// RunConnectionHealthChecks re-validates every verified connection (active or
+// failed) each interval until ctx is cancelled. Failed connections recover
+// automatically once the role can be assumed again. Only the leader checks.
+func (d *ServerDeps) RunConnectionHealthChecks(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.InfoContext(ctx, "connection health checks disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if d.isLeader() {
+			d.checkAllConnections(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *ServerDeps) checkAllConnections(ctx context.Context) {
+	// Retire rotated-out external IDs whose overlap window has passed.
+	if _, err := d.DB.ExecContext(ctx, `
+		UPDATE aws_connections
+		SET previous_external_id = NULL,
+		    previous_external_id_expires_at = NULL
+		WHERE previous_external_id_expires_at < NOW()
+	`); err != nil {
+		slog.ErrorContext(ctx, "connection health: expire previous external ids", logging.Err(err))
+	}
+
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT `+awsConnectionColumns+`
+		FROM aws_connections c
+		WHERE c.status IN ('active', 'failed')
+		ORDER BY c.last_checked_at IS NOT NULL, c.last_checked_at
+	`)
+	if err != nil {
+		slog.ErrorContext(ctx, "connection health: query connections", logging.Err(err))
+		return
+	}
+
+	var conns []*awsConnection
+	for rows.Next() {
+		conn, err := scanAWSConnection(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "connection health: scan connection", logging.Err(err))
+			rows.Close()
+			return
+		}
+		conns = append(conns, conn)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "connection health: rows error", logging.Err(err))
+		return
+	}
+
+	for _, conn := range conns {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := d.checkConnection(ctx, conn); err != nil {
+			slog.WarnContext(ctx, "connection health check failed", "connection_id", conn.ID, "role_arn", conn.RoleArn, logging.Err(err))
+		} else if conn.Status == "failed" {
+			slog.InfoContext(ctx, "connection recovered", "connection_id", conn.ID, "role_arn", conn.RoleArn)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// externalIDOverlap is how long a rotated-out external ID stays listed in the
+// trust policy, so runs enqueued before the rotation can still assume the role.
+const externalIDOverlap = 24 * time.Hour
+
+// trustedExternalIDs lists every external ID the role's trust policy must
+// currently accept: the active one, a rotated-out one still inside its
+// overlap window, and one awaiting verification.
+func (conn AWSConnectionResp) trustedExternalIDs() []string {
+	ids := []string{conn.ExternalID}
+	if conn.PreviousExternalID != nil &&
+		conn.PreviousExternalIDExpiresAt != nil && conn.PreviousExternalIDExpiresAt.After(time.Now()) {
+		ids = append(ids, *conn.PreviousExternalID)
+	}
+	if conn.PendingExternalID != nil {
+		ids = append(ids, *conn.PendingExternalID)
+	}
+	return ids
+}
+
+// POST /v1/connections/aws/:id/rotate-external-id
+// Step 1 of rotation: generates a new external ID and returns a trust policy
+// accepting both the current and the new ID. The current ID stays in use until
+// POST /v1/connections/aws/:id/verify succeeds with the new one. Calling this
+// again before verifying returns the same pending ID.
+func (d *ServerDeps) RotateAWSConnectionExternalID(c *gin.Context) {
+	connID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid connection id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	conn, err := loadAWSConnection(ctx, d.DB, connID, callerOrgID(c))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "connection not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+	if conn.Status == "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection has not been verified yet; nothing to rotate"})
+		return
+	}
+	if !conn.usesExternalID() {
+		c.JSON(http.StatusConflict, gin.H{"error": conn.CredentialProvider + " connections don't use an external id"})
+		return
+	}
+
+	if conn.PendingExternalID == "" {
+		externalID, err := generateExternalID()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate external id"})
+			return
+		}
+		if _, err := d.DB.ExecContext(ctx, `
+			UPDATE aws_connections
+			SET pending_external_id = ?
+			WHERE id = ? AND pending_external_id IS NULL
+		`, externalID, connID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store external id: " + err.Error()})
+			return
+		}
+	}
+
+	resp, err := d.connectionResp(ctx, connID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+
+	setup, err := d.connectionSetup(conn, resp.trustedExternalIDs())
+	if errors.Is(err, errNoPlatformPrincipal) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render setup snippets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AWSConnectionWithSetupResp{AWSConnectionResp: resp, Setup: setup})
+}
+
+// promotePendingExternalID is step 2 of rotation, run once the role has been
+// shown to accept the pending external ID: the pending ID becomes the active
+// one and the old ID is kept as previous_external_id for externalIDOverlap.
+func (d *ServerDeps) promotePendingExternalID(ctx context.Context, conn *awsConnection) error {
+	_, err := d.DB.ExecContext(ctx, `
+		UPDATE aws_connections
+		SET previous_external_id = external_id,
+		    previous_external_id_expires_at = ?,
+		    external_id = pending_external_id,
+		    pending_external_id = NULL,
+		    status = 'active',
+		    verified_at = NOW(),
+		    last_checked_at = NOW(),
+		    last_error = NULL
+		WHERE id = ? AND pending_external_id = ?
+	`, time.Now().Add(externalIDOverlap), conn.ID, conn.PendingExternalID)
+	return err
+}
@@ -3,20 +3,26 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"net/http"
 	"regexp"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/awsutil"
 )
 
 type CreateAWSConnectionReq struct {
-	RoleArn    string `json:"roleArn" binding:"required"`
-	ExternalID string `json:"externalId" binding:"required"`
-	Region     string `json:"region" binding:"required"`
-	Nickname   string `json:"nickname"`
+	RoleArn  string `json:"roleArn" binding:"required"`
+	Region   string `json:"region" binding:"required"`
+	Nickname string `json:"nickname"`
+
+	// Optional; defaults to assume_role. See credential_providers.go.
+	CredentialProvider string `json:"credentialProvider"`
+	HubRoleArn         string `json:"hubRoleArn"`
+	HubExternalID      string `json:"hubExternalId"`
+	STSEndpoint        string `json:"stsEndpoint"`
 }
 
 type AWSConnectionResp struct {
@@ -26,12 +32,125 @@ type AWSConnectionResp struct {
 	RoleArn    string `json:"roleArn"`
 	ExternalID string `json:"externalId"`
 	Region     string `json:"region"`
-	Nickname   string `json:"nickname,omitempty"`
+
+	// External ID rotation: the new ID awaiting verification, and the old ID
+	// still accepted by in-flight runs until its overlap window ends.
+	PendingExternalID           *string    `json:"pendingExternalId,omitempty"`
+	PreviousExternalID          *string    `json:"previousExternalId,omitempty"`
+	PreviousExternalIDExpiresAt *time.Time `json:"previousExternalIdExpiresAt,omitempty"`
+
+	Nickname string `json:"nickname,omitempty"`
+
+	CredentialProvider string `json:"credentialProvider"`
+	HubRoleArn         string `json:"hubRoleArn,omitempty"`
+	HubExternalID      string `json:"hubExternalId,omitempty"`
+	STSEndpoint        string `json:"stsEndpoint,omitempty"`
+
+	Status     string     `json:"status"` // "pending" until verified, then "active" or "failed"
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+
+	// Outcome of the most recent periodic or on-demand health check
+	LastCheckedAt *time.Time `json:"lastCheckedAt,omitempty"`
+	LastError     *string    `json:"lastError,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AWSConnectionWithSetupResp is a connection plus the trust policy snippets
+// the user applies before calling verify.
+type AWSConnectionWithSetupResp struct {
+	AWSConnectionResp
+	Setup ConnectionSetup `json:"setup"`
 }
 
 var roleArnRE = regexp.MustCompile(`^arn:aws:iam::([0-9]{12}):role\/.+$`)
 
+// connectionColumns is the SELECT list scanned by scanConnectionResp.
+const connectionColumns = `id, org_id, account_id, role_arn, external_id,
+	pending_external_id, previous_external_id, previous_external_id_expires_at,
+	region, nickname, credential_provider,
+	COALESCE(hub_role_arn, ''), COALESCE(hub_external_id, ''), COALESCE(sts_endpoint, ''),
+	status, verified_at, last_checked_at, last_error, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanConnectionResp(row rowScanner) (AWSConnectionResp, error) {
+	var conn AWSConnectionResp
+	var nickname sql.NullString
+	var pendingID, previousID sql.NullString
+	var previousExpiresAt sql.NullTime
+	var verifiedAt sql.NullTime
+	var lastCheckedAt sql.NullTime
+	var lastError sql.NullString
+
+	if err := row.Scan(
+		&conn.ID,
+		&conn.OrgID,
+		&conn.AccountID,
+		&conn.RoleArn,
+		&conn.ExternalID,
+		&pendingID,
+		&previousID,
+		&previousExpiresAt,
+		&conn.Region,
+		&nickname,
+		&conn.CredentialProvider,
+		&conn.HubRoleArn,
+		&conn.HubExternalID,
+		&conn.STSEndpoint,
+		&conn.Status,
+		&verifiedAt,
+		&lastCheckedAt,
+		&lastError,
+		&conn.CreatedAt,
+	); err != nil {
+		return conn, err
+	}
+
+	if nickname.Valid {
+		conn.Nickname = nickname.String
+	}
+	if pendingID.Valid {
+		id := pendingID.String
+		conn.PendingExternalID = &id
+	}
+	if previousID.Valid {
+		id := previousID.String
+		conn.PreviousExternalID = &id
+	}
+	if previousExpiresAt.Valid {
+		t := previousExpiresAt.Time
+		conn.PreviousExternalIDExpiresAt = &t
+	}
+	if verifiedAt.Valid {
+		t := verifiedAt.Time
+		conn.VerifiedAt = &t
+	}
+	if lastCheckedAt.Valid {
+		t := lastCheckedAt.Time
+		conn.LastCheckedAt = &t
+	}
+	if lastError.Valid {
+		e := lastError.String
+		conn.LastError = &e
+	}
+	return conn, nil
+}
+
+// connectionResp reloads a single connection for a response body.
+func (d *ServerDeps) connectionResp(ctx context.Context, connID int64) (AWSConnectionResp, error) {
+	return scanConnectionResp(d.DB.QueryRowContext(ctx,
+		`SELECT `+connectionColumns+` FROM aws_connections WHERE id = ?`,
+		connID,
+	))
+}
+
 // POST /v1/connections/aws
+// Step 1 of onboarding: creates a pending connection with a platform-generated
+// external ID and returns the trust policy to apply. Step 2 is
+// POST /v1/connections/aws/:id/verify.
 func (d *ServerDeps) CreateAWSConnection(c *gin.Context) {
 	var req CreateAWSConnectionReq
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -46,34 +165,46 @@ func (d *ServerDeps) CreateAWSConnection(c *gin.Context) {
 	}
 	accountID := m[1]
 
-	// Hard-coded for now; later: derive from JWT / org context.
-	const orgID int64 = 1
-	const userID int64 = 1
+	source := &awsConnection{
+		RoleArn:            req.RoleArn,
+		Region:             req.Region,
+		CredentialProvider: req.CredentialProvider,
+		HubRoleArn:         req.HubRoleArn,
+		HubExternalID:      req.HubExternalID,
+		STSEndpoint:        req.STSEndpoint,
+	}
+	if err := d.validateCredentialSource(source); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orgID := callerOrgID(c)
+	userID := callerUserID(c)
 
-	// 1) Validate role via STS AssumeRole
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
-	defer cancel()
+	ctx := c.Request.Context()
+
+	if !d.webIdentityRoleAllowed(c, orgID, source) {
+		return
+	}
 
-	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(req.Region))
+	// 1) Generate the external ID ourselves so it can't be guessed or reused
+	externalID, err := generateExternalID()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load AWS config"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate external id"})
 		return
 	}
 
-	stsClient := sts.NewFromConfig(awsCfg)
-	_, err = stsClient.AssumeRole(ctx, &sts.AssumeRoleInput{
-		RoleArn:         &req.RoleArn,
-		RoleSessionName: awsString("aip-validate"),
-		ExternalId:      awsString(req.ExternalID),
-		DurationSeconds: awsInt32(900),
-	})
+	setup, err := d.connectionSetup(source, []string{externalID})
+	if errors.Is(err, errNoPlatformPrincipal) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		// Surface as 400 so the user can fix the role/externalId.
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to assume role: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render setup snippets"})
 		return
 	}
 
-	// 2) Insert into aws_connections
+	// 2) Insert into aws_connections as pending
 	res, err := d.DB.ExecContext(ctx, `
 		INSERT INTO aws_connections (
 			org_id,
@@ -82,9 +213,15 @@ func (d *ServerDeps) CreateAWSConnection(c *gin.Context) {
 			external_id,
 			region,
 			nickname,
+			credential_provider,
+			hub_role_arn,
+			hub_external_id,
+			sts_endpoint,
+			status,
 			created_by
-		) VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, orgID, accountID, req.RoleArn, req.ExternalID, req.Region, req.Nickname, userID)
+		) VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), 'pending', ?)
+	`, orgID, accountID, req.RoleArn, externalID, req.Region, req.Nickname,
+		source.CredentialProvider, source.HubRoleArn, source.HubExternalID, source.STSEndpoint, userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert aws_connection: " + err.Error()})
 		return
@@ -96,32 +233,64 @@ func (d *ServerDeps) CreateAWSConnection(c *gin.Context) {
 		return
 	}
 
-	resp := AWSConnectionResp{
-		ID:         id,
-		OrgID:      orgID,
-		AccountID:  accountID,
-		RoleArn:    req.RoleArn,
-		ExternalID: req.ExternalID,
-		Region:     req.Region,
-		Nickname:   req.Nickname,
+	conn, err := d.connectionResp(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
 	}
 
-	c.JSON(http.StatusCreated, resp)
+	c.JSON(http.StatusCreated, AWSConnectionWithSetupResp{AWSConnectionResp: conn, Setup: setup})
+}
+
+// connectionSorts are the ?sort= keys accepted by ListAWSConnections.
+var connectionSorts = map[string]sortField{
+	"createdAt": {Column: "created_at", IsTime: true},
+	"accountId": {Column: "account_id"},
 }
 
 // GET /v1/connections/aws
+// Supports cursor pagination (?limit=, ?cursor=), ?sort= and the filters
+// accountId, region and status.
 func (d *ServerDeps) ListAWSConnections(c *gin.Context) {
-	// For now we hardcode org_id = 1 (same as POST)
-	const orgID int64 = 1
-
 	ctx := c.Request.Context()
 
+	lp, err := parseListParams(c, connectionSorts, "-createdAt")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := []string{"org_id = ?"}
+	args := []any{callerOrgID(c)}
+
+	if v := c.Query("accountId"); v != "" {
+		where = append(where, "account_id = ?")
+		args = append(args, v)
+	}
+	if v := c.Query("region"); v != "" {
+		where = append(where, "region = ?")
+		args = append(args, v)
+	}
+	if v := c.Query("status"); v != "" {
+		where = append(where, "status = ?")
+		args = append(args, v)
+	}
+
+	clause, cargs, err := lp.keyset("id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
 	rows, err := d.DB.QueryContext(ctx, `
-        SELECT id, org_id, account_id, role_arn, external_id, region, nickname
+        SELECT `+connectionColumns+`
         FROM aws_connections
-        WHERE org_id = ?
-        ORDER BY created_at DESC
-    `, orgID)
+        WHERE `+strings.Join(where, " AND ")+`
+        `+lp.orderBy("id"), args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query aws_connections"})
 		return
@@ -131,26 +300,12 @@ func (d *ServerDeps) ListAWSConnections(c *gin.Context) {
 	var conns []AWSConnectionResp
 
 	for rows.Next() {
-		var conn AWSConnectionResp
-		var nickname sql.NullString
-
-		if err := rows.Scan(
-			&conn.ID,
-			&conn.OrgID,
-			&conn.AccountID,
-			&conn.RoleArn,
-			&conn.ExternalID,
-			&conn.Region,
-			&nickname,
-		); err != nil {
+		conn, err := scanConnectionResp(rows)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to scan aws_connection"})
 			return
 		}
 
-		if nickname.Valid {
-			conn.Nickname = nickname.String
-		}
-
 		conns = append(conns, conn)
 	}
 
@@ -159,9 +314,328 @@ func (d *ServerDeps) ListAWSConnections(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, conns)
+	c.JSON(http.StatusOK, buildPage(c, lp, conns, func(conn AWSConnectionResp) (any, int64) {
+		if lp.Name == "accountId" {
+			return conn.AccountID, conn.ID
+		}
+		return conn.CreatedAt, conn.ID
+	}))
+}
+
+// UpdateAWSConnectionReq is a partial update; omitted fields are unchanged.
+type UpdateAWSConnectionReq struct {
+	Nickname *string `json:"nickname"`
+	Region   *string `json:"region"`
+	RoleArn  *string `json:"roleArn"`
+
+	CredentialProvider *string `json:"credentialProvider"`
+	HubRoleArn         *string `json:"hubRoleArn"`
+	HubExternalID      *string `json:"hubExternalId"`
+	STSEndpoint        *string `json:"stsEndpoint"`
+}
+
+// liveDeploymentIDs returns the deployments bound to a connection that have
+// not been torn down: anything not marked destroyed whose latest run is not a
+// successful destroy.
+func liveDeploymentIDs(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}, connID int64) ([]int64, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT dep.id
+		FROM deployments dep
+		LEFT JOIN runs r ON r.id = (
+			SELECT MAX(r2.id) FROM runs r2 WHERE r2.deployment_id = dep.id
+		)
+		WHERE dep.aws_connection_id = ?
+		  AND dep.status <> 'destroyed'
+		  AND NOT (r.id IS NOT NULL AND r.action = 'destroy' AND r.status = 'succeeded')
+		ORDER BY dep.id
+	`, connID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
 }
 
-// small helpers (same as in main.go, duplicated here for now)
-func awsString(s string) *string { return &s }
-func awsInt32(i int32) *int32    { return &i }
+// PATCH /v1/connections/aws/:id
+// Updates nickname, region, roleArn and/or the credential provider settings.
+// A new role ARN must stay in the same AWS account, and the region can't
+// change while live deployments use the connection (their resources would be
+// orphaned). Any change other than the nickname puts the connection back to
+// pending and re-verifies it immediately.
+func (d *ServerDeps) UpdateAWSConnection(c *gin.Context) {
+	connID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid connection id"})
+		return
+	}
+
+	var req UpdateAWSConnectionReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	conn, err := loadAWSConnection(ctx, d.DB, connID, callerOrgID(c))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "connection not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+
+	sets := []string{}
+	args := []any{}
+	reverify := false
+
+	if req.Nickname != nil {
+		sets = append(sets, "nickname = ?")
+		args = append(args, *req.Nickname)
+	}
+
+	if req.RoleArn != nil && *req.RoleArn != conn.RoleArn {
+		m := roleArnRE.FindStringSubmatch(*req.RoleArn)
+		if m == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid roleArn format"})
+			return
+		}
+		if m[1] != conn.AccountID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "roleArn must be in account " + conn.AccountID + "; create a new connection for another account"})
+			return
+		}
+		sets = append(sets, "role_arn = ?")
+		args = append(args, *req.RoleArn)
+		conn.RoleArn = *req.RoleArn
+		reverify = true
+	}
+
+	if req.Region != nil && *req.Region != conn.Region {
+		if *req.Region == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "region must not be empty"})
+			return
+		}
+		live, err := liveDeploymentIDs(ctx, d.DB, connID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check deployments"})
+			return
+		}
+		if len(live) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "region can't change while live deployments use this connection",
+				"deploymentIds": live,
+			})
+			return
+		}
+		sets = append(sets, "region = ?")
+		args = append(args, *req.Region)
+		conn.Region = *req.Region
+		reverify = true
+	}
+
+	if req.CredentialProvider != nil || req.HubRoleArn != nil || req.HubExternalID != nil || req.STSEndpoint != nil {
+		source := *conn
+		if req.CredentialProvider != nil {
+			source.CredentialProvider = *req.CredentialProvider
+		}
+		if req.HubRoleArn != nil {
+			source.HubRoleArn = *req.HubRoleArn
+		}
+		if req.HubExternalID != nil {
+			source.HubExternalID = *req.HubExternalID
+		}
+		if req.STSEndpoint != nil {
+			source.STSEndpoint = *req.STSEndpoint
+		}
+		if source.CredentialProvider != awsutil.ProviderHubChain && req.HubRoleArn == nil && req.HubExternalID == nil {
+			// Switching away from hub_chain drops its settings.
+			source.HubRoleArn, source.HubExternalID = "", ""
+		}
+		if err := d.validateCredentialSource(&source); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sets = append(sets,
+			"credential_provider = ?",
+			"hub_role_arn = NULLIF(?, '')",
+			"hub_external_id = NULLIF(?, '')",
+			"sts_endpoint = NULLIF(?, '')",
+		)
+		args = append(args, source.CredentialProvider, source.HubRoleArn, source.HubExternalID, source.STSEndpoint)
+		*conn = source
+		reverify = true
+	}
+
+	if reverify {
+		sets = append(sets, "status = 'pending'")
+	}
+
+	if reverify && !d.webIdentityRoleAllowed(c, callerOrgID(c), conn) {
+		return
+	}
+
+	if len(sets) > 0 {
+		args = append(args, connID)
+		if _, err := d.DB.ExecContext(ctx,
+			`UPDATE aws_connections SET `+strings.Join(sets, ", ")+` WHERE id = ?`,
+			args...,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update connection: " + err.Error()})
+			return
+		}
+	}
+
+	if reverify {
+		// On failure the connection stays pending with last_error set; the
+		// user fixes the trust policy and calls verify.
+		conn.Status = "pending"
+		_ = d.checkConnection(ctx, conn)
+	}
+
+	resp, err := d.connectionResp(ctx, connID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DELETE /v1/connections/aws/:id
+// Refuses with 409 while live deployments still use the connection, unless
+// ?reassignTo=<connectionId> names an active connection in the same account
+// to move them to. Torn-down deployments are detached.
+func (d *ServerDeps) DeleteAWSConnection(c *gin.Context) {
+	connID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid connection id"})
+		return
+	}
+
+	reassignTo, hasReassign, err := queryID(c, "reassignTo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	orgID := callerOrgID(c)
+
+	conn, err := loadAWSConnection(ctx, d.DB, connID, orgID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "connection not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+
+	if hasReassign {
+		if reassignTo == connID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo must be a different connection"})
+			return
+		}
+		target, err := loadAWSConnection(ctx, d.DB, reassignTo, orgID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo connection not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+			return
+		}
+		if target.AccountID != conn.AccountID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo must be a connection to account " + conn.AccountID})
+			return
+		}
+		if target.Region != conn.Region {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reassignTo must be a connection in region " + conn.Region})
+			return
+		}
+		if !target.usable() {
+			c.JSON(http.StatusConflict, gin.H{"error": "reassignTo connection is " + target.Status + "; verify it first"})
+			return
+		}
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin tx"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Lock the connection row: binding a new deployment to it (FK check)
+	// waits until we're done, so the liveness check below can't go stale.
+	var lockedID int64
+	if err := tx.QueryRowContext(ctx,
+		`SELECT id FROM aws_connections WHERE id = ? FOR UPDATE`,
+		connID,
+	).Scan(&lockedID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "connection not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lock connection"})
+		return
+	}
+
+	if hasReassign {
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE deployments SET aws_connection_id = ? WHERE aws_connection_id = ?`,
+			reassignTo, connID,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reassign deployments: " + err.Error()})
+			return
+		}
+	} else {
+		live, err := liveDeploymentIDs(ctx, tx, connID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check deployments"})
+			return
+		}
+		if len(live) > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":         "connection is still used by live deployments; destroy them or pass ?reassignTo=<connectionId>",
+				"deploymentIds": live,
+			})
+			return
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE deployments SET aws_connection_id = NULL WHERE aws_connection_id = ?`,
+			connID,
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to detach deployments: " + err.Error()})
+			return
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM aws_connections WHERE id = ?`, connID)
+	if isRowReferenced(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection is still referenced; retry"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete connection: " + err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/awsutil"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+// validateCredentialSource checks the provider settings on conn, defaulting
+// an empty provider to assume_role.
+func (d *ServerDeps) validateCredentialSource(conn *awsConnection) error {
+	if conn.CredentialProvider == "" {
+		conn.CredentialProvider = awsutil.ProviderAssumeRole
+	}
+	if !awsutil.ValidProvider(conn.CredentialProvider) {
+		return fmt.Errorf("invalid credentialProvider; must be one of assume_role, hub_chain, web_identity, static")
+	}
+
+	if conn.CredentialProvider == awsutil.ProviderHubChain {
+		if !roleArnRE.MatchString(conn.HubRoleArn) {
+			return errors.New("hub_chain requires a valid hubRoleArn")
+		}
+	} else if conn.HubRoleArn != "" || conn.HubExternalID != "" {
+		return errors.New("hubRoleArn and hubExternalId only apply to hub_chain")
+	}
+
+	if conn.CredentialProvider == awsutil.ProviderStatic && !d.AllowStaticCredentials {
+		return errors.New("static credentials are disabled on this platform")
+	}
+
+	if conn.CredentialProvider == awsutil.ProviderWebIdentity && !d.AllowWebIdentity {
+		return errors.New("web_identity connections are disabled on this platform")
+	}
+
+	return awsutil.ValidSTSEndpoint(conn.STSEndpoint)
+}
+
+// webIdentityRoleAllowed checks that orgID may use conn's role, answering
+// 403 (or 500) and returning false if not. Only web_identity is restricted:
+// its roles trust the worker itself rather than an org's external ID, so
+// platform operators list them per org in web_identity_roles.
+func (d *ServerDeps) webIdentityRoleAllowed(c *gin.Context, orgID int64, conn *awsConnection) bool {
+	if conn.CredentialProvider != awsutil.ProviderWebIdentity {
+		return true
+	}
+	var one int
+	err := d.DB.QueryRowContext(c.Request.Context(),
+		`SELECT 1 FROM web_identity_roles WHERE org_id = ? AND role_arn = ?`,
+		orgID, conn.RoleArn,
+	).Scan(&one)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusForbidden, gin.H{"error": "roleArn is not allowed for web_identity in this org; ask a platform operator to allow it"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check web identity roles"})
+		return false
+	}
+	return true
+}
+
+// trustPrincipal is the principal the connection's role must trust: the hub
+// role when chaining, the platform principal otherwise.
+func (d *ServerDeps) trustPrincipal(conn *awsConnection) string {
+	if conn.CredentialProvider == awsutil.ProviderHubChain {
+		return conn.HubRoleArn
+	}
+	return d.PlatformPrincipal
+}
+
+// usesExternalID reports whether the provider presents an external ID to STS.
+func (conn *awsConnection) usesExternalID() bool {
+	return conn.CredentialProvider != awsutil.ProviderWebIdentity && conn.CredentialProvider != awsutil.ProviderStatic
+}
+
+// verifyRole checks that the platform can obtain credentials for conn's role
+// the same way the worker will, presenting externalID where it applies.
+func (d *ServerDeps) verifyRole(ctx context.Context, conn *awsConnection, externalID string) error {
+	switch conn.CredentialProvider {
+	case awsutil.ProviderStatic:
+		// Keys live only in the worker's environment; nothing to check here.
+		return nil
+	case awsutil.ProviderWebIdentity:
+		// The role trusts the worker's OIDC token, which the API doesn't
+		// hold; assuming it with any other token proves nothing. The
+		// operator-maintained allowlist stands in, and the first run is the
+		// real check.
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	target := conn.jobAWS()
+	target.ExternalID = externalID
+
+	awsCfg, err := roleConfig(ctx, target, "aip-validate")
+	if err != nil {
+		return err
+	}
+	_, err = awsCfg.Credentials.Retrieve(ctx)
+	return err
+}
+
+// roleConfig returns an AWS config whose credentials are target's role,
+// obtained the way the worker obtains them. Credentials are fetched lazily.
+// Static and web_identity targets have no credentials on the API side and
+// are an error.
+func roleConfig(ctx context.Context, target jobs.AWSTarget, sessionName string) (aws.Config, error) {
+	switch target.CredentialProvider {
+	case awsutil.ProviderStatic:
+		return aws.Config{}, errors.New("static connections use the worker's own keys")
+
+	case awsutil.ProviderWebIdentity:
+		return aws.Config{}, errors.New("web_identity connections use the worker's OIDC token")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(target.Region))
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if target.CredentialProvider == awsutil.ProviderHubChain {
+		awsCfg = awsutil.ViaHubRole(awsCfg, target.STSEndpoint, target.HubRoleArn, target.HubExternalID, sessionName+"-hub")
+	}
+
+	awsCfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(
+		awsutil.NewSTSClient(awsCfg, target.STSEndpoint),
+		target.RoleArn,
+		func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = sessionName
+			o.ExternalID = aws.String(target.ExternalID)
+			o.Duration = 15 * time.Minute
+		},
+	))
+	return awsCfg, nil
+}
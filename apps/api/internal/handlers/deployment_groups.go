@@ -0,0 +1,607 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// Failure policies for a deployment group.
+const (
+	FailurePolicyStop     = "stop"     // cancel runs not yet started once one fails
+	FailurePolicyContinue = "continue" // run every target regardless
+)
+
+const (
+	// DefaultGroupDispatchInterval is how often pending group runs are released.
+	DefaultGroupDispatchInterval = 5 * time.Second
+
+	maxGroupTargets = 50
+)
+
+// DeploymentTarget is one connection (and optionally a region other than the
+// connection's own) a group deploys into.
+type DeploymentTarget struct {
+	ConnectionID int64  `json:"connectionId" binding:"required"`
+	Region       string `json:"region"`
+}
+
+type CreateDeploymentGroupReq struct {
+	BlueprintKey  string             `json:"blueprintKey" binding:"required"`
+	Version       string             `json:"version" binding:"required"`
+	EnvironmentID int64              `json:"environmentId" binding:"required"`
+	Inputs        map[string]any     `json:"inputs"`
+	Action        string             `json:"action"` // "plan" or "apply" (defaults to "plan")
+	Targets       []DeploymentTarget `json:"targets" binding:"required,min=1,dive"`
+
+	// How many targets run at once (default 1) and what happens when one fails
+	// ("stop", the default, or "continue").
+	MaxConcurrency int    `json:"maxConcurrency"`
+	FailurePolicy  string `json:"failurePolicy"`
+
+	// Expiry for every target's deployment, as on CreateDeploymentReq
+	TTLSeconds *int64 `json:"ttlSeconds"`
+}
+
+// GroupTarget is one deployment of a group and the state of its group run.
+type GroupTarget struct {
+	DeploymentID int64      `json:"deploymentId"`
+	ConnectionID *int64     `json:"connectionId,omitempty"`
+	AccountID    string     `json:"accountId,omitempty"`
+	Region       string     `json:"region"`
+	RunID        int64      `json:"runId"`
+	RunStatus    string     `json:"runStatus"`
+	Summary      *string    `json:"summary,omitempty"`
+	StartedAt    *time.Time `json:"startedAt,omitempty"`
+	FinishedAt   *time.Time `json:"finishedAt,omitempty"`
+}
+
+type DeploymentGroupResp struct {
+	ID             int64          `json:"id"`
+	EnvironmentID  int64          `json:"environmentId"`
+	Blueprint      BlueprintRef   `json:"blueprint"`
+	Action         string         `json:"action"`
+	MaxConcurrency int            `json:"maxConcurrency"`
+	FailurePolicy  string         `json:"failurePolicy"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	Status         string         `json:"status"` // running, succeeded, failed or partially_failed
+	Counts         map[string]int `json:"counts"` // group runs by status
+	Targets        []GroupTarget  `json:"targets"`
+}
+
+// POST /v1/deployment-groups
+// Creates one deployment per target, linked by a group, and releases their
+// runs maxConcurrency at a time. Poll GET /v1/deployment-groups/:id for
+// progress.
+func (d *ServerDeps) CreateDeploymentGroup(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var req CreateDeploymentGroupReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action == "" {
+		action = jobs.ActionPlan
+	}
+	if action != jobs.ActionPlan && action != jobs.ActionApply {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action; must be 'plan' or 'apply'"})
+		return
+	}
+
+	if len(req.Targets) > maxGroupTargets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d targets per group", maxGroupTargets)})
+		return
+	}
+
+	concurrency := req.MaxConcurrency
+	if concurrency == 0 {
+		concurrency = 1
+	}
+	if concurrency < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "maxConcurrency must be positive"})
+		return
+	}
+	if concurrency > len(req.Targets) {
+		concurrency = len(req.Targets)
+	}
+
+	policy := req.FailurePolicy
+	if policy == "" {
+		policy = FailurePolicyStop
+	}
+	if policy != FailurePolicyStop && policy != FailurePolicyContinue {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid failurePolicy; must be 'stop' or 'continue'"})
+		return
+	}
+
+	if !d.checkInputs(c, req.BlueprintKey, req.Version, req.Inputs) {
+		return
+	}
+
+	orgID := callerOrgID(c)
+	userID := callerUserID(c)
+
+	inputsJSON, err := json.Marshal(req.Inputs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to encode inputs"})
+		return
+	}
+
+	// Every target must be a usable connection in the org, and each
+	// connection/region pair may appear once.
+	conns := make([]*awsConnection, len(req.Targets))
+	seen := map[string]bool{}
+	for i, t := range req.Targets {
+		conn, err := loadAWSConnection(ctx, d.DB, t.ConnectionID, orgID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("targets[%d]: unknown connection", i)})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve connection: " + err.Error()})
+			return
+		}
+		if !conn.usable() {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("targets[%d]: connection is %s; re-verify it before deploying", i, conn.Status)})
+			return
+		}
+
+		region := conn.Region
+		if t.Region != "" {
+			region = t.Region
+		}
+		key := strconv.FormatInt(conn.ID, 10) + "/" + region
+		if seen[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("targets[%d]: duplicate connection/region", i)})
+			return
+		}
+		seen[key] = true
+		conns[i] = conn
+	}
+
+	// Pre-flight every connection once; IAM is global, so the region is moot.
+	// This calls STS and IAM, so it runs before the transaction is opened.
+	checked := map[int64]bool{}
+	for _, conn := range conns {
+		if checked[conn.ID] {
+			continue
+		}
+		checked[conn.ID] = true
+		if !d.preflight(c, conn, req.BlueprintKey, req.Version, action, req.Inputs) {
+			return
+		}
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	ok, err := environmentInOrg(ctx, tx, req.EnvironmentID, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve environment: " + err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown environment"})
+		return
+	}
+
+	expiresAt, err := deploymentExpiry(ctx, tx, req.EnvironmentID, req.TTLSeconds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var blueprintID int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT id FROM blueprints WHERE blueprint_key = ? AND version = ?`,
+		req.BlueprintKey, req.Version,
+	).Scan(&blueprintID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown blueprint"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve blueprint: " + err.Error()})
+		return
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO deployment_groups (
+			environment_id,
+			blueprint_id,
+			action,
+			max_concurrency,
+			failure_policy,
+			created_by
+		) VALUES (?, ?, ?, ?, ?, ?)
+	`, req.EnvironmentID, blueprintID, action, concurrency, policy, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert deployment group: " + err.Error()})
+		return
+	}
+	groupID, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get deployment group id"})
+		return
+	}
+
+	for i, t := range req.Targets {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO deployments (
+				blueprint_id,
+				environment_id,
+				aws_connection_id,
+				deployment_group_id,
+				region,
+				status,
+				inputs_json,
+				expires_at,
+				created_by
+			) VALUES (?, ?, ?, ?, NULLIF(?, ''), 'pending', ?, ?, ?)
+		`, blueprintID, req.EnvironmentID, conns[i].ID, groupID, t.Region, string(inputsJSON), expiresAt, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert deployment: " + err.Error()})
+			return
+		}
+		deploymentID, err := res.LastInsertId()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get deployment id"})
+			return
+		}
+		revisionID, _, err := insertRevision(ctx, tx, deploymentID, blueprintID, string(inputsJSON), RevisionSourceCreate, &userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert revision: " + err.Error()})
+			return
+		}
+
+		// Group runs wait as 'pending' until dispatchGroup releases them.
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO runs (
+				deployment_id,
+				deployment_group_id,
+				action,
+				status,
+				triggered_by,
+				revision_id
+			) VALUES (?, ?, ?, 'pending', ?, ?)
+		`, deploymentID, groupID, action, userID, revisionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert run: " + err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit transaction"})
+		return
+	}
+
+	// Release the first batch now; the dispatcher loop handles the rest.
+	if err := d.dispatchGroup(context.WithoutCancel(ctx), groupID); err != nil {
+		slog.ErrorContext(ctx, "deployment group: initial dispatch", "deployment_group_id", groupID, logging.Err(err))
+	}
+
+	group, err := d.loadDeploymentGroup(ctx, groupID, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment group"})
+		return
+	}
+	c.JSON(http.StatusAccepted, group)
+}
+
+// GET /v1/deployment-groups/:id
+// Returns the group with per-target run state and an aggregate status.
+func (d *ServerDeps) GetDeploymentGroup(c *gin.Context) {
+	groupID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment group id"})
+		return
+	}
+
+	group, err := d.loadDeploymentGroup(c.Request.Context(), groupID, callerOrgID(c))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment group not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment group"})
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+func (d *ServerDeps) loadDeploymentGroup(ctx context.Context, groupID, orgID int64) (DeploymentGroupResp, error) {
+	var g DeploymentGroupResp
+	err := d.DB.QueryRowContext(ctx, `
+		SELECT g.id, g.environment_id, bp.blueprint_key, bp.version, bp.provider,
+		       g.action, g.max_concurrency, g.failure_policy, g.created_at
+		FROM deployment_groups g
+		JOIN blueprints bp ON bp.id = g.blueprint_id
+		JOIN environments env ON env.id = g.environment_id
+		JOIN projects p ON p.id = env.project_id
+		WHERE g.id = ? AND p.org_id = ?
+	`, groupID, orgID).Scan(
+		&g.ID,
+		&g.EnvironmentID,
+		&g.Blueprint.Key,
+		&g.Blueprint.Version,
+		&g.Blueprint.Provider,
+		&g.Action,
+		&g.MaxConcurrency,
+		&g.FailurePolicy,
+		&g.CreatedAt,
+	)
+	if err != nil {
+		return g, err
+	}
+
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT dep.id, dep.aws_connection_id, COALESCE(c.account_id, ''),
+		       COALESCE(dep.region, c.region, ''),
+		       r.id, r.status, r.summary, r.started_at, r.finished_at
+		FROM runs r
+		JOIN deployments dep ON dep.id = r.deployment_id
+		LEFT JOIN aws_connections c ON c.id = dep.aws_connection_id
+		WHERE r.deployment_group_id = ?
+		ORDER BY dep.id
+	`, groupID)
+	if err != nil {
+		return g, err
+	}
+	defer rows.Close()
+
+	g.Targets = []GroupTarget{}
+	g.Counts = map[string]int{}
+	for rows.Next() {
+		var (
+			t          GroupTarget
+			connID     sql.NullInt64
+			summary    sql.NullString
+			startedAt  sql.NullTime
+			finishedAt sql.NullTime
+		)
+		if err := rows.Scan(
+			&t.DeploymentID,
+			&connID,
+			&t.AccountID,
+			&t.Region,
+			&t.RunID,
+			&t.RunStatus,
+			&summary,
+			&startedAt,
+			&finishedAt,
+		); err != nil {
+			return g, err
+		}
+		if connID.Valid {
+			id := connID.Int64
+			t.ConnectionID = &id
+		}
+		if summary.Valid {
+			s := summary.String
+			t.Summary = &s
+		}
+		if startedAt.Valid {
+			ts := startedAt.Time
+			t.StartedAt = &ts
+		}
+		if finishedAt.Valid {
+			ts := finishedAt.Time
+			t.FinishedAt = &ts
+		}
+		g.Counts[t.RunStatus]++
+		g.Targets = append(g.Targets, t)
+	}
+	if err := rows.Err(); err != nil {
+		return g, err
+	}
+
+	g.Status = groupStatus(g.Counts)
+	return g, nil
+}
+
+// groupStatus aggregates the group's run statuses.
+func groupStatus(counts map[string]int) string {
+	switch {
+	case counts["pending"]+counts["queued"]+counts["running"]+counts["awaiting_approval"] > 0:
+		return "running"
+	case counts["failed"]+counts["timed_out"]+counts["cancelled"]+counts["rejected"]+counts["expired"] == 0:
+		return "succeeded"
+	case counts["succeeded"] == 0:
+		return "failed"
+	default:
+		return "partially_failed"
+	}
+}
+
+// dispatchGroup releases pending runs of a group up to its max_concurrency,
+// or cancels them if a run failed under the 'stop' policy. The group row is
+// locked so concurrent dispatchers can't over-release.
+func (d *ServerDeps) dispatchGroup(ctx context.Context, groupID int64) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		concurrency int
+		policy      string
+	)
+	if err := tx.QueryRowContext(ctx,
+		`SELECT max_concurrency, failure_policy FROM deployment_groups WHERE id = ? FOR UPDATE`,
+		groupID,
+	).Scan(&concurrency, &policy); err != nil {
+		return fmt.Errorf("lock group: %w", err)
+	}
+
+	var inFlight, failed int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT
+			COALESCE(SUM(status IN ('queued', 'running', 'awaiting_approval')), 0),
+			COALESCE(SUM(status IN ('failed', 'timed_out', 'rejected', 'expired')), 0)
+		FROM runs
+		WHERE deployment_group_id = ?
+	`, groupID).Scan(&inFlight, &failed); err != nil {
+		return fmt.Errorf("count runs: %w", err)
+	}
+
+	if policy == FailurePolicyStop && failed > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE runs
+			SET status = 'cancelled',
+			    summary = 'cancelled: another target in the group failed',
+			    finished_at = NOW()
+			WHERE deployment_group_id = ? AND status = 'pending'
+		`, groupID); err != nil {
+			return fmt.Errorf("cancel pending runs: %w", err)
+		}
+		return tx.Commit()
+	}
+
+	slots := concurrency - inFlight
+	if slots <= 0 {
+		return tx.Commit()
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM runs
+		WHERE deployment_group_id = ? AND status = 'pending'
+		ORDER BY id
+		LIMIT ?
+	`, groupID, slots)
+	if err != nil {
+		return fmt.Errorf("select pending runs: %w", err)
+	}
+	var runIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		runIDs = append(runIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var release []jobs.Job
+	for _, runID := range runIDs {
+		job, conn, err := runJob(ctx, tx, runID)
+		if err == nil && !conn.usable() {
+			err = fmt.Errorf("connection is %s", conn.Status)
+		}
+		if err != nil {
+			// Fail just this run; the failure policy decides about the rest
+			// on the next pass.
+			if _, err2 := tx.ExecContext(ctx, `
+				UPDATE runs SET status = 'failed', summary = ?, finished_at = NOW() WHERE id = ?
+			`, "not started: "+err.Error(), runID); err2 != nil {
+				return err2
+			}
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE runs SET status = 'queued' WHERE id = ?`, runID,
+		); err != nil {
+			return err
+		}
+		release = append(release, job)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, job := range release {
+		if err := d.enqueueJob(ctx, job); err != nil {
+			// Put it back so the next pass retries it.
+			rctx := logging.WithRun(ctx, job.RunID)
+			slog.ErrorContext(rctx, "deployment group: enqueue run", "deployment_group_id", groupID, logging.Err(err))
+			if _, err := d.DB.ExecContext(ctx,
+				`UPDATE runs SET status = 'pending' WHERE id = ? AND status = 'queued'`, job.RunID,
+			); err != nil {
+				slog.ErrorContext(rctx, "deployment group: reset run to pending", "deployment_group_id", groupID, logging.Err(err))
+			}
+		}
+	}
+	return nil
+}
+
+// RunGroupDispatcher releases pending group runs as earlier ones finish, every
+// interval until ctx is cancelled.
+func (d *ServerDeps) RunGroupDispatcher(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.InfoContext(ctx, "deployment group dispatcher disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.dispatchAllGroups(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *ServerDeps) dispatchAllGroups(ctx context.Context) {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT DISTINCT deployment_group_id
+		FROM runs
+		WHERE deployment_group_id IS NOT NULL AND status = 'pending'
+	`)
+	if err != nil {
+		slog.ErrorContext(ctx, "group dispatcher: query groups", logging.Err(err))
+		return
+	}
+
+	var groupIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			slog.ErrorContext(ctx, "group dispatcher: scan group", logging.Err(err))
+			rows.Close()
+			return
+		}
+		groupIDs = append(groupIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "group dispatcher: rows error", logging.Err(err))
+		return
+	}
+
+	for _, id := range groupIDs {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := d.dispatchGroup(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "deployment group: dispatch", "deployment_group_id", id, logging.Err(err))
+		}
+	}
+}
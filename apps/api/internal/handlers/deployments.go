@@ -4,20 +4,25 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	redis "github.com/redis/go-redis/v9"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
 )
 
 type DeploymentSummary struct {
 	ID                int64      `json:"id"`
 	BlueprintKey      string     `json:"blueprintKey"`
 	Version           string     `json:"version"`
+	ProjectID         int64      `json:"projectId"`
 	EnvironmentID     int64      `json:"environmentId"`
+	EnvironmentName   string     `json:"environmentName"`
+	ConnectionID      *int64     `json:"connectionId,omitempty"`
 	Status            string     `json:"status"`
 	CreatedAt         time.Time  `json:"createdAt"`
 	LastRunID         *int64     `json:"lastRunId,omitempty"`
@@ -25,7 +30,17 @@ type DeploymentSummary struct {
 	LastRunStartedAt  *time.Time `json:"lastRunStartedAt,omitempty"`
 	LastRunFinishedAt *time.Time `json:"lastRunFinishedAt,omitempty"`
 
-	// Raw terraform outputs JSON (terraform output -json)
+	// Result of the latest drift run
+	Drifted        bool       `json:"drifted"`
+	DriftCheckedAt *time.Time `json:"driftCheckedAt,omitempty"`
+
+	// Ephemeral deployments: when they'll be destroyed, and when the
+	// pre-expiry warning was raised
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	ExpiryWarnedAt *time.Time `json:"expiryWarnedAt,omitempty"`
+
+	// Raw terraform outputs JSON (terraform output -json), sensitive values
+	// redacted
 	OutputsJSON json.RawMessage `json:"outputsJson,omitempty"`
 }
 
@@ -33,6 +48,30 @@ type DeploymentSummary struct {
 type ServerDeps struct {
 	DB  *sql.DB
 	RDB *redis.Client
+
+	// How long Idempotency-Key responses are kept for replay
+	IdempotencyTTL time.Duration
+
+	// AWS principal customers trust in their deploy role policy
+	// (e.g. "arn:aws:iam::<platform-account>:root")
+	PlatformPrincipal string
+
+	// Whether connections may use the worker's static keys (local testing)
+	AllowStaticCredentials bool
+
+	// Permit "web_identity" connections, for the roles listed for the org in
+	// web_identity_roles
+	AllowWebIdentity bool
+
+	// Directory holding <key>/<version>/schema.yaml for each blueprint
+	BlueprintsRoot string
+
+	// Checks a role against a blueprint's declared permissions before a run
+	// is enqueued (nil skips the check)
+	Permissions PermissionChecker
+
+	// Set while this instance holds the leader lock; see RunLeaderElection
+	leader atomic.Bool
 }
 
 // Request body for creating a deployment
@@ -41,20 +80,13 @@ type CreateDeploymentReq struct {
 	Version       string         `json:"version" binding:"required"`
 	EnvironmentID int64          `json:"environmentId" binding:"required"`
 	Inputs        map[string]any `json:"inputs"`
-	AWS           struct {
-		RoleArn    string `json:"roleArn" binding:"required"`
-		ExternalID string `json:"externalId" binding:"required"`
-		Region     string `json:"region" binding:"required"`
-	} `json:"aws"`
-	Action string `json:"action"` // "plan" or "apply" (optional, defaults to "plan")
-}
-
-type DestroyDeploymentReq struct {
-	AWS struct {
-		RoleArn    string `json:"roleArn" binding:"required"`
-		ExternalID string `json:"externalId" binding:"required"`
-		Region     string `json:"region" binding:"required"`
-	} `json:"aws"`
+	// Saved AWS connection the deployment is bound to; every later run
+	// resolves its role/externalId/region from it server-side.
+	ConnectionID int64  `json:"connectionId" binding:"required"`
+	Action       string `json:"action"` // "plan" or "apply" (optional, defaults to "plan")
+	// Seconds until the deployment is destroyed automatically; 0 means never.
+	// Defaults to the environment's defaultTtlSeconds.
+	TTLSeconds *int64 `json:"ttlSeconds"`
 }
 
 func (d *ServerDeps) CreateDeployment(c *gin.Context) {
@@ -76,8 +108,12 @@ func (d *ServerDeps) CreateDeployment(c *gin.Context) {
 		return
 	}
 
-	// Temporary: we use the seeded user ID = 1.
-	const hardcodedUserID int64 = 1
+	if !d.checkInputs(c, req.BlueprintKey, req.Version, req.Inputs) {
+		return
+	}
+
+	orgID := callerOrgID(c)
+	userID := callerUserID(c)
 
 	// Convert inputs to JSON for deployments.inputs_json
 	inputsJSON, err := json.Marshal(req.Inputs)
@@ -86,6 +122,27 @@ func (d *ServerDeps) CreateDeployment(c *gin.Context) {
 		return
 	}
 
+	// 1) Resolve the AWS connection (must belong to the caller's org)
+	conn, err := loadAWSConnection(ctx, d.DB, req.ConnectionID, orgID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown connection"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve connection: " + err.Error()})
+		return
+	}
+	if !conn.usable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection is " + conn.Status + "; re-verify it (POST /v1/connections/aws/:id/verify) before deploying"})
+		return
+	}
+
+	// 2) Pre-flight: the role must allow what the blueprint declares. This
+	// calls STS and IAM, so it runs before the transaction is opened.
+	if !d.preflight(c, conn, req.BlueprintKey, req.Version, action, req.Inputs) {
+		return
+	}
+
 	tx, err := d.DB.BeginTx(ctx, nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin transaction"})
@@ -93,7 +150,24 @@ func (d *ServerDeps) CreateDeployment(c *gin.Context) {
 	}
 	defer tx.Rollback() // safe even if we commit
 
-	// 1) Look up blueprint_id from key + version
+	// 3) The target environment must belong to the caller's org
+	ok, err := environmentInOrg(ctx, tx, req.EnvironmentID, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve environment: " + err.Error()})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown environment"})
+		return
+	}
+
+	expiresAt, err := deploymentExpiry(ctx, tx, req.EnvironmentID, req.TTLSeconds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 4) Look up blueprint_id from key + version
 	var blueprintID int64
 	err = tx.QueryRowContext(ctx,
 		`SELECT id FROM blueprints WHERE blueprint_key = ? AND version = ?`,
@@ -108,20 +182,24 @@ func (d *ServerDeps) CreateDeployment(c *gin.Context) {
 		return
 	}
 
-	// 2) Insert into deployments
+	// 5) Insert into deployments
 	res, err := tx.ExecContext(ctx, `
 		INSERT INTO deployments (
 			blueprint_id,
 			environment_id,
+			aws_connection_id,
 			status,
 			inputs_json,
+			expires_at,
 			created_by
-		) VALUES (?, ?, 'pending', ?, ?)
+		) VALUES (?, ?, ?, 'pending', ?, ?, ?)
 	`,
 		blueprintID,
 		req.EnvironmentID,
+		conn.ID,
 		string(inputsJSON),
-		hardcodedUserID,
+		expiresAt,
+		userID,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert deployment: " + err.Error()})
@@ -133,8 +211,13 @@ func (d *ServerDeps) CreateDeployment(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get deployment id"})
 		return
 	}
+	revisionID, _, err := insertRevision(ctx, tx, deploymentID, blueprintID, string(inputsJSON), RevisionSourceCreate, &userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert revision: " + err.Error()})
+		return
+	}
 
-	// 3) Insert into runs (action from request, status=queued)
+	// 6) Insert into runs (action from request, status=queued)
 	res, err = tx.ExecContext(ctx, `
 		INSERT INTO runs (
 			deployment_id,
@@ -143,11 +226,15 @@ func (d *ServerDeps) CreateDeployment(c *gin.Context) {
 			artifacts_uri,
 			summary,
 			started_at,
-			finished_at
-		) VALUES (?, ?, 'queued', NULL, NULL, NULL, NULL)
+			finished_at,
+			triggered_by,
+			revision_id
+		) VALUES (?, ?, 'queued', NULL, NULL, NULL, NULL, ?, ?)
 	`,
 		deploymentID,
 		action,
+		userID,
+		revisionID,
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert run: " + err.Error()})
@@ -160,67 +247,155 @@ func (d *ServerDeps) CreateDeployment(c *gin.Context) {
 		return
 	}
 
-	// 4) Commit transaction
+	// 7) Commit transaction
 	if err := tx.Commit(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit transaction"})
 		return
 	}
 
-	// 5) Enqueue job with the real runID
-	job := map[string]any{
-		"run_id":        runID,
-		"action":        action,
-		"blueprint_key": req.BlueprintKey,
-		"version":       req.Version,
-		"inputs":        req.Inputs,
-		"aws": map[string]string{
-			"roleArn":    req.AWS.RoleArn,
-			"externalId": req.AWS.ExternalID,
-			"region":     req.AWS.Region,
-		},
+	// 8) Enqueue job with the real runID
+	job := jobs.Job{
+		RunID:        runID,
+		Action:       action,
+		BlueprintKey: req.BlueprintKey,
+		Version:      req.Version,
+		Inputs:       req.Inputs,
+		AWS:          conn.jobAWS(),
 	}
 
-	payload, err := json.Marshal(job)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode job"})
-		return
-	}
-
-	if err := d.RDB.RPush(context.Background(), "aip:jobs", payload).Err(); err != nil {
+	if err := d.enqueueJob(context.WithoutCancel(ctx), job); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue job: " + err.Error()})
 		return
 	}
 
-	// 6) Return real IDs
-	c.JSON(http.StatusAccepted, gin.H{
+	// 9) Return real IDs
+	resp := gin.H{
 		"deploymentId": deploymentID,
 		"runId":        runID,
 		"status":       "queued",
-	})
+	}
+	if expiresAt != nil {
+		resp["expiresAt"] = *expiresAt
+	}
+	c.JSON(http.StatusAccepted, resp)
+}
+
+// deploymentSorts are the ?sort= keys accepted by ListDeployments.
+var deploymentSorts = map[string]sortField{
+	"createdAt": {Column: "dep.created_at", IsTime: true},
+	"status":    {Column: "CAST(dep.status AS CHAR)"}, // by name, not enum index, to match the cursor comparison
 }
 
+// deploymentStatuses are the values of deployments.status, accepted by
+// ListDeployments' ?status= filter.
+var deploymentStatuses = []string{"pending", "planning", "planned", "applying", "applied", "failed", "destroying", "destroyed"}
+
 // GET /v1/deployments
-// For now: environment_id is hard-coded to 1 (dev)
+// Lists deployments in the caller's org. Supports cursor pagination
+// (?limit=, ?cursor=), ?sort= and the filters projectId, environmentId,
+// deploymentGroupId, status, blueprintKey, drifted, createdBy, createdAfter,
+// createdBefore and expiresBefore.
 func (d *ServerDeps) ListDeployments(c *gin.Context) {
-	const envID int64 = 1
-
 	ctx := c.Request.Context()
 
+	lp, err := parseListParams(c, deploymentSorts, "-createdAt")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := []string{"p.org_id = ?"}
+	args := []any{callerOrgID(c)}
+
+	for _, f := range []struct{ param, column string }{
+		{"projectId", "env.project_id"},
+		{"environmentId", "dep.environment_id"},
+		{"deploymentGroupId", "dep.deployment_group_id"},
+		{"createdBy", "dep.created_by"},
+	} {
+		id, ok, err := queryID(c, f.param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if ok {
+			where = append(where, f.column+" = ?")
+			args = append(args, id)
+		}
+	}
+	status, err := queryEnum(c, "status", deploymentStatuses...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if status != "" {
+		where = append(where, "dep.status = ?")
+		args = append(args, status)
+	}
+	if v := c.Query("blueprintKey"); v != "" {
+		where = append(where, "bp.blueprint_key = ?")
+		args = append(args, v)
+	}
+	switch c.Query("drifted") {
+	case "":
+	case "true":
+		where = append(where, "dep.drifted")
+	case "false":
+		where = append(where, "NOT dep.drifted")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "drifted must be true or false"})
+		return
+	}
+	for _, f := range []struct{ param, column, op string }{
+		{"createdAfter", "dep.created_at", ">="},
+		{"createdBefore", "dep.created_at", "<"},
+		{"expiresBefore", "dep.expires_at", "<"},
+	} {
+		t, err := queryTime(c, f.param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if t != nil {
+			where = append(where, f.column+" "+f.op+" ?")
+			args = append(args, *t)
+		}
+	}
+
+	clause, cargs, err := lp.keyset("dep.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
 	rows, err := d.DB.QueryContext(ctx, `
         SELECT
             dep.id,
             bp.blueprint_key,
             bp.version,
+            env.project_id,
             dep.environment_id,
+            env.name,
+            dep.aws_connection_id,
             dep.status,
             dep.created_at,
             dep.outputs_json,
+            dep.drifted,
+            dep.drift_checked_at,
+            dep.expires_at,
+            dep.expiry_warned_at,
             lr.id AS last_run_id,
             lr.status AS last_run_status,
             lr.started_at AS last_run_started_at,
             lr.finished_at AS last_run_finished_at
         FROM deployments dep
         JOIN blueprints bp ON dep.blueprint_id = bp.id
+        JOIN environments env ON dep.environment_id = env.id
+        JOIN projects p ON env.project_id = p.id
         LEFT JOIN (
             SELECT r1.*
             FROM runs r1
@@ -232,9 +407,8 @@ func (d *ServerDeps) ListDeployments(c *gin.Context) {
             ON mr.deployment_id = r1.deployment_id AND mr.max_id = r1.id
         ) lr
         ON lr.deployment_id = dep.id
-        WHERE dep.environment_id = ?
-        ORDER BY dep.created_at DESC
-    `, envID)
+        WHERE `+strings.Join(where, " AND ")+`
+        `+lp.orderBy("dep.id"), args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query deployments"})
 		return
@@ -245,20 +419,31 @@ func (d *ServerDeps) ListDeployments(c *gin.Context) {
 
 	for rows.Next() {
 		var s DeploymentSummary
+		var connID sql.NullInt64
 		var lastRunID sql.NullInt64
 		var lastRunStatus sql.NullString
 		var lastRunStartedAt sql.NullTime
 		var lastRunFinishedAt sql.NullTime
 		var outputsRaw sql.NullString
+		var driftCheckedAt sql.NullTime
+		var expiresAt sql.NullTime
+		var expiryWarnedAt sql.NullTime
 
 		if err := rows.Scan(
 			&s.ID,
 			&s.BlueprintKey,
 			&s.Version,
+			&s.ProjectID,
 			&s.EnvironmentID,
+			&s.EnvironmentName,
+			&connID,
 			&s.Status,
 			&s.CreatedAt,
 			&outputsRaw,
+			&s.Drifted,
+			&driftCheckedAt,
+			&expiresAt,
+			&expiryWarnedAt,
 			&lastRunID,
 			&lastRunStatus,
 			&lastRunStartedAt,
@@ -268,6 +453,10 @@ func (d *ServerDeps) ListDeployments(c *gin.Context) {
 			return
 		}
 
+		if connID.Valid {
+			id := connID.Int64
+			s.ConnectionID = &id
+		}
 		if lastRunID.Valid {
 			id := lastRunID.Int64
 			s.LastRunID = &id
@@ -285,7 +474,19 @@ func (d *ServerDeps) ListDeployments(c *gin.Context) {
 			s.LastRunFinishedAt = &t
 		}
 		if outputsRaw.Valid {
-			s.OutputsJSON = json.RawMessage(outputsRaw.String)
+			s.OutputsJSON = redactOutputs(json.RawMessage(outputsRaw.String))
+		}
+		if driftCheckedAt.Valid {
+			t := driftCheckedAt.Time
+			s.DriftCheckedAt = &t
+		}
+		if expiresAt.Valid {
+			t := expiresAt.Time
+			s.ExpiresAt = &t
+		}
+		if expiryWarnedAt.Valid {
+			t := expiryWarnedAt.Time
+			s.ExpiryWarnedAt = &t
 		}
 
 		list = append(list, s)
@@ -296,39 +497,198 @@ func (d *ServerDeps) ListDeployments(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, list)
+	c.JSON(http.StatusOK, buildPage(c, lp, list, func(s DeploymentSummary) (any, int64) {
+		if lp.Name == "status" {
+			return s.Status, s.ID
+		}
+		return s.CreatedAt, s.ID
+	}))
 }
 
+// POST /v1/deployments/:id/destroy
+// Queues a destroy run. Refused with 409 while another run is active (or a
+// retry of one is waiting) and for deployments that were never applied.
 func (d *ServerDeps) DestroyDeployment(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
 	ctx := c.Request.Context()
 
-	// Parse deployment ID from URL
-	deploymentIDStr := c.Param("id")
-	var deploymentID int64
-	if _, err := fmt.Sscan(deploymentIDStr, &deploymentID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
 		return
 	}
 
-	var req DestroyDeploymentReq
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Destroy with the same role that created the resources
+	job, conn, err := deploymentJob(ctx, d.DB, deploymentID, jobs.ActionDestroy)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is not bound to an AWS connection"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve deployment: " + err.Error()})
+		return
+	}
+	if !conn.usable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection is " + conn.Status + "; re-verify it (POST /v1/connections/aws/:id/verify) before destroying"})
+		return
+	}
+	if !d.preflight(c, conn, job.BlueprintKey, job.Version, jobs.ActionDestroy, job.Inputs) {
 		return
 	}
 
-	// Look up blueprint + inputs for this deployment
+	// Under the deployment's lock: refused while another run is active or
+	// if nothing was ever applied
+	userID := callerUserID(c)
+	runID, err := d.startDeploymentRun(ctx, deploymentID, jobs.ActionDestroy, &userID)
+	if errors.Is(err, errRunInProgress) || errors.Is(err, errNotDeployed) || errors.Is(err, errConnectionUnusable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start destroy run: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"deploymentId": deploymentID,
+		"runId":        runID,
+		"status":       "queued",
+	})
+}
+
+type BlueprintRef struct {
+	Key      string `json:"key"`
+	Version  string `json:"version"`
+	Provider string `json:"provider"`
+}
+
+type EnvironmentRef struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	ProjectID int64  `json:"projectId"`
+}
+
+type UserRef struct {
+	ID    int64  `json:"id"`
+	Email string `json:"email"`
+}
+
+type DeploymentDetail struct {
+	ID           int64           `json:"id"`
+	Status       string          `json:"status"`
+	Blueprint    BlueprintRef    `json:"blueprint"`
+	Environment  EnvironmentRef  `json:"environment"`
+	ConnectionID *int64          `json:"connectionId,omitempty"`
+	CreatedBy    UserRef         `json:"createdBy"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	CostEstimate *float64        `json:"costEstimate,omitempty"`
+	Inputs       any             `json:"inputs"`                 // sensitive values redacted
+	Revision     int             `json:"revision"`               // current revision of blueprint version + inputs
+	Outputs      json.RawMessage `json:"outputs,omitempty"`      // sensitive values redacted
+	OutputsRunID *int64          `json:"outputsRunId,omitempty"` // apply the outputs were captured after
+	LastRun      *RunSummary     `json:"lastRun,omitempty"`
+
+	// Result of the latest drift run: resources changed outside terraform
+	// and the changes an apply would make
+	Drifted        bool            `json:"drifted"`
+	DriftCheckedAt *time.Time      `json:"driftCheckedAt,omitempty"`
+	DriftDetails   json.RawMessage `json:"driftDetails,omitempty"`
+
+	// Ephemeral deployments: when they'll be destroyed, when the pre-expiry
+	// warning was raised, and the destroy run started at expiry
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+	ExpiryWarnedAt *time.Time `json:"expiryWarnedAt,omitempty"`
+	ExpiryRunID    *int64     `json:"expiryRunId,omitempty"`
+}
+
+// GET /v1/deployments/:id
+func (d *ServerDeps) GetDeployment(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
 	var (
-		blueprintKey string
-		version      string
-		inputsJSON   string
+		dd         DeploymentDetail
+		inputsRaw  string
+		outputsRaw sql.NullString
+		outputsRun sql.NullInt64
+		cost       sql.NullFloat64
+		connID     sql.NullInt64
+		driftAt    sql.NullTime
+		driftRaw   sql.NullString
+		expiresAt  sql.NullTime
+		warnedAt   sql.NullTime
+		expiryRun  sql.NullInt64
 	)
-
 	err := d.DB.QueryRowContext(ctx, `
-        SELECT bp.blueprint_key, bp.version, dep.inputs_json
+        SELECT
+            dep.id,
+            dep.status,
+            dep.inputs_json,
+            dep.outputs_json,
+            dep.outputs_run_id,
+            dep.cost_estimate,
+            dep.created_at,
+            dep.aws_connection_id,
+            dep.drifted,
+            dep.drift_checked_at,
+            dep.drift_details_json,
+            dep.expires_at,
+            dep.expiry_warned_at,
+            dep.expiry_run_id,
+            COALESCE((SELECT MAX(rev.revision) FROM deployment_revisions rev WHERE rev.deployment_id = dep.id), 0),
+            bp.blueprint_key,
+            bp.version,
+            bp.provider,
+            env.id,
+            env.name,
+            env.project_id,
+            u.id,
+            u.email
         FROM deployments dep
         JOIN blueprints bp ON dep.blueprint_id = bp.id
-        WHERE dep.id = ?
-    `, deploymentID).Scan(&blueprintKey, &version, &inputsJSON)
+        JOIN environments env ON dep.environment_id = env.id
+        JOIN projects p ON env.project_id = p.id
+        JOIN users u ON dep.created_by = u.id
+        WHERE dep.id = ? AND p.org_id = ?
+    `, deploymentID, callerOrgID(c)).Scan(
+		&dd.ID,
+		&dd.Status,
+		&inputsRaw,
+		&outputsRaw,
+		&outputsRun,
+		&cost,
+		&dd.CreatedAt,
+		&connID,
+		&dd.Drifted,
+		&driftAt,
+		&driftRaw,
+		&expiresAt,
+		&warnedAt,
+		&expiryRun,
+		&dd.Revision,
+		&dd.Blueprint.Key,
+		&dd.Blueprint.Version,
+		&dd.Blueprint.Provider,
+		&dd.Environment.ID,
+		&dd.Environment.Name,
+		&dd.Environment.ProjectID,
+		&dd.CreatedBy.ID,
+		&dd.CreatedBy.Email,
+	)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
 		return
@@ -338,63 +698,188 @@ func (d *ServerDeps) DestroyDeployment(c *gin.Context) {
 		return
 	}
 
-	var inputs map[string]any
-	if err := json.Unmarshal([]byte(inputsJSON), &inputs); err != nil {
+	var inputs any
+	if err := json.Unmarshal([]byte(inputsRaw), &inputs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode inputs_json"})
 		return
 	}
+	dd.Inputs = redactInputs(inputs)
+
+	if outputsRaw.Valid {
+		dd.Outputs = redactOutputs(json.RawMessage(outputsRaw.String))
+	}
+	if outputsRun.Valid {
+		id := outputsRun.Int64
+		dd.OutputsRunID = &id
+	}
+	if cost.Valid {
+		v := cost.Float64
+		dd.CostEstimate = &v
+	}
+	if connID.Valid {
+		id := connID.Int64
+		dd.ConnectionID = &id
+	}
+	if driftAt.Valid {
+		t := driftAt.Time
+		dd.DriftCheckedAt = &t
+	}
+	if driftRaw.Valid {
+		dd.DriftDetails = json.RawMessage(driftRaw.String)
+	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		dd.ExpiresAt = &t
+	}
+	if warnedAt.Valid {
+		t := warnedAt.Time
+		dd.ExpiryWarnedAt = &t
+	}
+	if expiryRun.Valid {
+		id := expiryRun.Int64
+		dd.ExpiryRunID = &id
+	}
 
-	// Insert a new run with action='destroy'
-	res, err := d.DB.ExecContext(ctx, `
-        INSERT INTO runs (
-            deployment_id,
-            action,
-            status,
-            artifacts_uri,
-            summary,
-            started_at,
-            finished_at
-        ) VALUES (?, 'destroy', 'queued', NULL, NULL, NULL, NULL)
-    `, deploymentID)
+	runs, err := d.queryRuns(ctx, "r.deployment_id = ?", []any{deploymentID}, "ORDER BY r.id DESC LIMIT 1")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert destroy run: " + err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query last run"})
 		return
 	}
+	if len(runs) > 0 {
+		dd.LastRun = &runs[0]
+	}
 
-	runID, err := res.LastInsertId()
+	c.JSON(http.StatusOK, dd)
+}
+
+// Request body for changing a deployment's inputs
+type UpdateDeploymentReq struct {
+	// Merge patch over the current inputs: listed inputs are set (objects
+	// merged key by key), null unsets one, and unlisted inputs are kept.
+	Inputs map[string]any `json:"inputs" binding:"required"`
+	Action string         `json:"action"` // "plan" or "apply" (optional, defaults to "plan")
+}
+
+// PATCH /v1/deployments/:id
+// Changes some of a deployment's inputs. The merged inputs are validated
+// against the blueprint's schema, stored as the deployment's next revision,
+// and a run of them is queued against its existing state.
+func (d *ServerDeps) UpdateDeployment(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	var req UpdateDeploymentReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action == "" {
+		action = jobs.ActionPlan
+	}
+	if action != jobs.ActionPlan && action != jobs.ActionApply {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action; must be 'plan' or 'apply'"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var (
+		blueprintID int64
+		key         string
+		version     string
+		status      string
+		inputsJSON  string
+		revisionID  int64
+	)
+	err := d.DB.QueryRowContext(ctx, `
+		SELECT dep.blueprint_id, bp.blueprint_key, bp.version, dep.status, dep.inputs_json, `+currentRevisionSQL+`
+		FROM deployments dep
+		JOIN blueprints bp ON bp.id = dep.blueprint_id
+		JOIN environments env ON env.id = dep.environment_id
+		JOIN projects p ON p.id = env.project_id
+		WHERE dep.id = ? AND p.org_id = ?
+	`, deploymentID, deploymentID, callerOrgID(c)).Scan(&blueprintID, &key, &version, &status, &inputsJSON, &revisionID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get run id"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment: " + err.Error()})
+		return
+	}
+	if status == "destroyed" {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is destroyed"})
 		return
 	}
 
-	// Enqueue job (same shape as CreateDeployment)
-	job := map[string]any{
-		"run_id":        runID,
-		"action":        "destroy",
-		"blueprint_key": blueprintKey,
-		"version":       version,
-		"inputs":        inputs,
-		"aws": map[string]string{
-			"roleArn":    req.AWS.RoleArn,
-			"externalId": req.AWS.ExternalID,
-			"region":     req.AWS.Region,
-		},
+	var current map[string]any
+	if err := json.Unmarshal([]byte(inputsJSON), &current); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode inputs_json"})
+		return
+	}
+
+	inputs := mergeInputs(current, req.Inputs)
+	changes := diffInputs(current, inputs)
+	if len(changes) == 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "inputs are unchanged"})
+		return
 	}
 
-	payload, err := json.Marshal(job)
+	if !d.checkInputs(c, key, version, inputs) {
+		return
+	}
+
+	newInputsJSON, err := json.Marshal(inputs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode job"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to encode inputs"})
 		return
 	}
 
-	if err := d.RDB.RPush(context.Background(), "aip:jobs", payload).Err(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enqueue job: " + err.Error()})
+	conn, err := loadDeploymentConnection(ctx, d.DB, deploymentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is not bound to an AWS connection"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve connection: " + err.Error()})
+		return
+	}
+	if !conn.usable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection is " + conn.Status + "; re-verify it (POST /v1/connections/aws/:id/verify) before updating"})
+		return
+	}
+	if !d.preflight(c, conn, key, version, action, inputs) {
+		return
+	}
+
+	userID := callerUserID(c)
+	runID, revision, err := d.startRevisedRun(ctx, deploymentID, &revisionChange{
+		BlueprintID:    blueprintID,
+		InputsJSON:     string(newInputsJSON),
+		Source:         RevisionSourceUpdate,
+		BaseRevisionID: revisionID,
+	}, action, &userID)
+	if errors.Is(err, errRunInProgress) || errors.Is(err, errConnectionUnusable) || errors.Is(err, errRevisionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start run: " + err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusAccepted, gin.H{
 		"deploymentId": deploymentID,
 		"runId":        runID,
+		"action":       action,
 		"status":       "queued",
+		"revision":     revision,
+		"changes":      changes,
+		"inputs":       redactInputs(inputs),
 	})
 }
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+const (
+	// DefaultDriftCheckInterval is how often each applied deployment gets a
+	// scheduled drift run.
+	DefaultDriftCheckInterval = 24 * time.Hour
+
+	// How often the scheduler looks for due deployments, and how many drift
+	// runs it starts per look so a large fleet is spread out.
+	driftScanInterval = time.Minute
+	driftBatchSize    = 20
+)
+
+// deployedRunsCondition holds for a deployment (aliased dep) that has been
+// applied and not since destroyed.
+const deployedRunsCondition = `
+	dep.status <> 'destroyed'
+	AND EXISTS (
+		SELECT 1 FROM runs ra
+		WHERE ra.deployment_id = dep.id AND ra.action = 'apply' AND ra.status = 'succeeded'
+	)
+	AND NOT EXISTS (
+		SELECT 1 FROM runs rl
+		WHERE rl.id = (SELECT MAX(r2.id) FROM runs r2 WHERE r2.deployment_id = dep.id)
+		  AND rl.action = 'destroy' AND rl.status = 'succeeded'
+	)`
+
+// POST /v1/deployments/:id/drift
+// Queues a drift run (refresh + plan -detailed-exitcode) now. The result
+// lands on the deployment's drifted, driftCheckedAt and driftDetails.
+func (d *ServerDeps) TriggerDriftCheck(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+
+	job, conn, err := deploymentJob(ctx, d.DB, deploymentID, jobs.ActionDrift)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is not bound to an AWS connection"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve deployment: " + err.Error()})
+		return
+	}
+	if !conn.usable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection is " + conn.Status + "; re-verify it (POST /v1/connections/aws/:id/verify) before checking drift"})
+		return
+	}
+	if !d.preflight(c, conn, job.BlueprintKey, job.Version, jobs.ActionDrift, job.Inputs) {
+		return
+	}
+
+	userID := callerUserID(c)
+	runID, err := d.startDeploymentRun(ctx, deploymentID, jobs.ActionDrift, &userID)
+	if errors.Is(err, errRunInProgress) || errors.Is(err, errNotDeployed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start drift run: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"deploymentId": deploymentID,
+		"runId":        runID,
+		"status":       "queued",
+	})
+}
+
+// RunDriftScheduler starts a drift run for every applied deployment whose
+// last drift run is older than interval, until ctx is cancelled. Only the
+// leader starts runs. Deployments with a run in progress or an unusable
+// connection are skipped until a later pass.
+func (d *ServerDeps) RunDriftScheduler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.InfoContext(ctx, "drift scheduler disabled")
+		return
+	}
+
+	scan := min(driftScanInterval, interval)
+	ticker := time.NewTicker(scan)
+	defer ticker.Stop()
+
+	for {
+		d.scheduleDriftChecks(ctx, interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *ServerDeps) scheduleDriftChecks(ctx context.Context, interval time.Duration) {
+	if !d.isLeader() {
+		return
+	}
+
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT dep.id
+		FROM deployments dep
+		JOIN aws_connections c ON c.id = dep.aws_connection_id
+		WHERE c.status = 'active'
+		  AND `+deployedRunsCondition+`
+		  AND NOT EXISTS (
+			SELECT 1 FROM runs rb
+			WHERE rb.deployment_id = dep.id AND rb.status IN ('pending', 'queued', 'running', 'awaiting_approval')
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM runs rd
+			WHERE rd.deployment_id = dep.id AND rd.action = 'drift'
+			  AND rd.created_at > NOW() - INTERVAL ? SECOND
+		  )
+		ORDER BY dep.drift_checked_at IS NOT NULL, dep.drift_checked_at, dep.id
+		LIMIT ?
+	`, int64(interval/time.Second), driftBatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "drift scheduler: query deployments", logging.Err(err))
+		return
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			slog.ErrorContext(ctx, "drift scheduler: scan deployment", logging.Err(err))
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "drift scheduler: rows error", logging.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		dctx := logging.WithDeployment(ctx, id)
+		runID, err := d.startDeploymentRun(dctx, id, jobs.ActionDrift, nil)
+		if errors.Is(err, errRunInProgress) || errors.Is(err, errNotDeployed) || errors.Is(err, errConnectionUnusable) {
+			continue // changed since the query; try again next pass
+		}
+		if err != nil {
+			slog.ErrorContext(dctx, "start drift run", logging.Err(err))
+			continue
+		}
+		slog.InfoContext(logging.WithRun(dctx, runID), "scheduled drift run")
+	}
+}
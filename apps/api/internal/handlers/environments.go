@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EnvironmentReq struct {
+	Name string `json:"name" binding:"required"` // "dev", "stg" or "prod"
+	// TTL given to new deployments that don't set their own; 0 clears it.
+	// Left unchanged on update when omitted.
+	DefaultTTLSeconds *int64 `json:"defaultTtlSeconds"`
+	// Approvals an apply needs before it runs (0 disables the gate), and how
+	// long a planned apply waits for them. Left unchanged on update when
+	// omitted.
+	RequiredApprovals  *int   `json:"requiredApprovals"`
+	ApprovalTTLSeconds *int64 `json:"approvalTtlSeconds"`
+}
+
+type EnvironmentResp struct {
+	ID                 int64  `json:"id"`
+	ProjectID          int64  `json:"projectId"`
+	Name               string `json:"name"`
+	DefaultTTLSeconds  *int64 `json:"defaultTtlSeconds,omitempty"`
+	RequiredApprovals  int    `json:"requiredApprovals"`
+	ApprovalTTLSeconds int64  `json:"approvalTtlSeconds"`
+}
+
+// defaultTTLArg validates req's defaultTtlSeconds and returns it as a column
+// value (nil for "no default").
+func (req EnvironmentReq) defaultTTLArg() (any, error) {
+	if req.DefaultTTLSeconds == nil || *req.DefaultTTLSeconds == 0 {
+		return nil, nil
+	}
+	if err := validTTL(*req.DefaultTTLSeconds); err != nil {
+		return nil, errors.New("invalid defaultTtlSeconds: " + err.Error())
+	}
+	return *req.DefaultTTLSeconds, nil
+}
+
+// validateApprovals checks req's approval settings, when given.
+func (req EnvironmentReq) validateApprovals() error {
+	if req.RequiredApprovals != nil && (*req.RequiredApprovals < 0 || *req.RequiredApprovals > maxRequiredApprovals) {
+		return fmt.Errorf("requiredApprovals must be between 0 and %d", maxRequiredApprovals)
+	}
+	if req.ApprovalTTLSeconds != nil {
+		return validApprovalTTL(*req.ApprovalTTLSeconds)
+	}
+	return nil
+}
+
+// normalizeEnvName validates an environment name against the environments.name ENUM.
+func normalizeEnvName(name string) (string, bool) {
+	n := strings.ToLower(strings.TrimSpace(name))
+	switch n {
+	case "dev", "stg", "prod":
+		return n, true
+	}
+	return "", false
+}
+
+// POST /v1/projects/:id/environments
+func (d *ServerDeps) CreateEnvironment(c *gin.Context) {
+	projectID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid project id"})
+		return
+	}
+
+	var req EnvironmentReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, ok := normalizeEnvName(req.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid name; must be 'dev', 'stg' or 'prod'"})
+		return
+	}
+	defaultTTL, err := req.defaultTTLArg()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateApprovals(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	env := EnvironmentResp{
+		ProjectID:          projectID,
+		Name:               name,
+		ApprovalTTLSeconds: int64(DefaultApprovalTTL / time.Second),
+	}
+	if req.RequiredApprovals != nil {
+		env.RequiredApprovals = *req.RequiredApprovals
+	}
+	if req.ApprovalTTLSeconds != nil {
+		env.ApprovalTTLSeconds = *req.ApprovalTTLSeconds
+	}
+	if defaultTTL != nil {
+		env.DefaultTTLSeconds = req.DefaultTTLSeconds
+	}
+
+	exists, err := d.projectExists(c, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load project"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+
+	res, err := d.DB.ExecContext(c.Request.Context(),
+		`INSERT INTO environments (project_id, name, default_ttl_seconds, required_approvals, approval_ttl_seconds) VALUES (?, ?, ?, ?, ?)`,
+		projectID, name, defaultTTL, env.RequiredApprovals, env.ApprovalTTLSeconds,
+	)
+	if isDuplicateKey(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "environment already exists in this project"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert environment: " + err.Error()})
+		return
+	}
+
+	env.ID, err = res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get environment id"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, env)
+}
+
+// GET /v1/projects/:id/environments
+func (d *ServerDeps) ListEnvironments(c *gin.Context) {
+	projectID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid project id"})
+		return
+	}
+
+	exists, err := d.projectExists(c, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load project"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+
+	envs, err := d.queryEnvironments(c, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query environments"})
+		return
+	}
+
+	// A project has at most one environment per stage, so this always fits
+	// on a single page; the envelope keeps the shape consistent.
+	c.JSON(http.StatusOK, Page[EnvironmentResp]{Items: envs})
+}
+
+// GET /v1/environments/:id
+func (d *ServerDeps) GetEnvironment(c *gin.Context) {
+	envID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid environment id"})
+		return
+	}
+
+	env, err := d.loadEnvironment(c, envID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "environment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load environment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, env)
+}
+
+// PATCH /v1/environments/:id
+func (d *ServerDeps) UpdateEnvironment(c *gin.Context) {
+	envID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid environment id"})
+		return
+	}
+
+	var req EnvironmentReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name, ok := normalizeEnvName(req.Name)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid name; must be 'dev', 'stg' or 'prod'"})
+		return
+	}
+	defaultTTL, err := req.defaultTTLArg()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.validateApprovals(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	env, err := d.loadEnvironment(c, envID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "environment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load environment"})
+		return
+	}
+
+	_, err = d.DB.ExecContext(c.Request.Context(), `
+		UPDATE environments
+		SET name = ?,
+		    default_ttl_seconds = IF(?, ?, default_ttl_seconds),
+		    required_approvals = COALESCE(?, required_approvals),
+		    approval_ttl_seconds = COALESCE(?, approval_ttl_seconds)
+		WHERE id = ?
+	`, name, req.DefaultTTLSeconds != nil, defaultTTL, req.RequiredApprovals, req.ApprovalTTLSeconds, envID)
+	if isDuplicateKey(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "environment already exists in this project"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update environment: " + err.Error()})
+		return
+	}
+
+	env.Name = name
+	if req.DefaultTTLSeconds != nil {
+		env.DefaultTTLSeconds = nil
+		if defaultTTL != nil {
+			env.DefaultTTLSeconds = req.DefaultTTLSeconds
+		}
+	}
+	if req.RequiredApprovals != nil {
+		env.RequiredApprovals = *req.RequiredApprovals
+	}
+	if req.ApprovalTTLSeconds != nil {
+		env.ApprovalTTLSeconds = *req.ApprovalTTLSeconds
+	}
+	c.JSON(http.StatusOK, env)
+}
+
+// DELETE /v1/environments/:id
+// Refuses while deployments still reference the environment.
+func (d *ServerDeps) DeleteEnvironment(c *gin.Context) {
+	envID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid environment id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if _, err := d.loadEnvironment(c, envID); err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "environment not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load environment"})
+		return
+	}
+
+	var depCount int
+	if err := d.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM deployments WHERE environment_id = ?`,
+		envID,
+	).Scan(&depCount); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count deployments"})
+		return
+	}
+	if depCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "environment still has deployments"})
+		return
+	}
+
+	if _, err := d.DB.ExecContext(ctx, `DELETE FROM environments WHERE id = ?`, envID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete environment: " + err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// loadEnvironment returns the environment if it belongs to the caller's org,
+// or sql.ErrNoRows otherwise.
+func (d *ServerDeps) loadEnvironment(c *gin.Context, envID int64) (EnvironmentResp, error) {
+	var (
+		env        EnvironmentResp
+		defaultTTL sql.NullInt64
+	)
+	err := d.DB.QueryRowContext(c.Request.Context(), `
+		SELECT e.id, e.project_id, e.name, e.default_ttl_seconds, e.required_approvals, e.approval_ttl_seconds
+		FROM environments e
+		JOIN projects p ON p.id = e.project_id
+		WHERE e.id = ? AND p.org_id = ?
+	`, envID, callerOrgID(c)).Scan(&env.ID, &env.ProjectID, &env.Name, &defaultTTL, &env.RequiredApprovals, &env.ApprovalTTLSeconds)
+	if defaultTTL.Valid {
+		v := defaultTTL.Int64
+		env.DefaultTTLSeconds = &v
+	}
+	return env, err
+}
+
+func (d *ServerDeps) queryEnvironments(c *gin.Context, projectID int64) ([]EnvironmentResp, error) {
+	rows, err := d.DB.QueryContext(c.Request.Context(), `
+		SELECT id, project_id, name, default_ttl_seconds, required_approvals, approval_ttl_seconds
+		FROM environments
+		WHERE project_id = ?
+		ORDER BY id
+	`, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	envs := []EnvironmentResp{}
+	for rows.Next() {
+		var (
+			e          EnvironmentResp
+			defaultTTL sql.NullInt64
+		)
+		if err := rows.Scan(&e.ID, &e.ProjectID, &e.Name, &defaultTTL, &e.RequiredApprovals, &e.ApprovalTTLSeconds); err != nil {
+			return nil, err
+		}
+		if defaultTTL.Valid {
+			v := defaultTTL.Int64
+			e.DefaultTTLSeconds = &v
+		}
+		envs = append(envs, e)
+	}
+	return envs, rows.Err()
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx so lookups can run
+// inside or outside a transaction.
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// OrgIDHeader picks which of the caller's orgs a request acts on; without
+// it, the caller's first org (lowest id) is used.
+const OrgIDHeader = "X-Org-ID"
+
+// Gin context keys set by Caller.
+const (
+	callerUserIDKey = "caller_user_id"
+	callerOrgIDKey  = "caller_org_id"
+)
+
+// Caller resolves the email the JWT middleware authenticated to the users
+// row and the org membership the request acts under. Callers who aren't a
+// member of the org (or of any org) get 403. It must run after the JWT
+// middleware.
+func (d *ServerDeps) Caller() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var orgFilter *int64
+		if v := c.GetHeader(OrgIDHeader); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || id <= 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid " + OrgIDHeader})
+				return
+			}
+			orgFilter = &id
+		}
+
+		var userID, orgID int64
+		err := d.DB.QueryRowContext(c.Request.Context(), `
+			SELECT u.id, m.org_id
+			FROM users u
+			JOIN memberships m ON m.user_id = u.id
+			WHERE u.email = ? AND (? IS NULL OR m.org_id = ?)
+			ORDER BY m.org_id
+			LIMIT 1
+		`, c.GetString("user_email"), orgFilter, orgFilter).Scan(&userID, &orgID)
+		if err == sql.ErrNoRows {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "caller is not a member of the org"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve caller"})
+			return
+		}
+
+		c.Set(callerUserIDKey, userID)
+		c.Set(callerOrgIDKey, orgID)
+		c.Next()
+	}
+}
+
+// callerOrgID returns the org the current request acts on, as resolved by
+// Caller.
+func callerOrgID(c *gin.Context) int64 {
+	return c.GetInt64(callerOrgIDKey)
+}
+
+// callerUserID returns the users.id of the caller, as resolved by Caller.
+func callerUserID(c *gin.Context) int64 {
+	return c.GetInt64(callerUserIDKey)
+}
+
+// idParam parses a positive int64 path parameter.
+func idParam(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// isDuplicateKey reports whether err is a MySQL unique constraint violation.
+func isDuplicateKey(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
+
+// isRowReferenced reports whether err is a MySQL foreign key violation caused
+// by deleting or updating a row that other rows still reference.
+func isRowReferenced(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1451
+}
+
+// environmentInOrg reports whether the environment exists and belongs to a
+// project owned by orgID.
+func environmentInOrg(ctx context.Context, q querier, envID, orgID int64) (bool, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `
+		SELECT e.id
+		FROM environments e
+		JOIN projects p ON p.id = e.project_id
+		WHERE e.id = ? AND p.org_id = ?
+	`, envID, orgID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// deploymentInOrg reports whether the deployment exists and lives in an
+// environment owned by orgID.
+func deploymentInOrg(ctx context.Context, q querier, deploymentID, orgID int64) (bool, error) {
+	var id int64
+	err := q.QueryRowContext(ctx, `
+		SELECT dep.id
+		FROM deployments dep
+		JOIN environments e ON e.id = dep.environment_id
+		JOIN projects p ON p.id = e.project_id
+		WHERE dep.id = ? AND p.org_id = ?
+	`, deploymentID, orgID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// contextWithTimeout returns a background context for work that must finish
+// even after the request context is cancelled.
+func contextWithTimeout(d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), d)
+}
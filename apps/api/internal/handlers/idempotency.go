@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	DefaultIdempotencyTTL     = 24 * time.Hour
+	maxIdempotencyKeyLength   = 255
+	idempotencyPurgeBatchSize = 100
+)
+
+// captureWriter tees the response body so it can be stored for replay.
+type captureWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency honours the Idempotency-Key header on mutating requests.
+//
+// Keys are scoped to the calling user. The first request with a given key
+// runs normally and its response is stored for IdempotencyTTL; repeats with
+// the same method, path and body get the stored response back (with
+// Idempotent-Replayed: true). Reusing a key for a different request is
+// rejected with 422, and a repeat that arrives while the first one is still
+// running gets 409. 5xx responses (including handler panics) are not stored,
+// so the client can retry them. It must run after Caller.
+func (d *ServerDeps) Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key too long"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.New()
+		sum.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		sum.Write(body)
+		requestHash := hex.EncodeToString(sum.Sum(nil))
+
+		ctx := c.Request.Context()
+		orgID, userID := callerOrgID(c), callerUserID(c)
+
+		ttl := d.IdempotencyTTL
+		if ttl <= 0 {
+			ttl = DefaultIdempotencyTTL
+		}
+
+		// Expired keys are free to reuse; also trim a batch of other expired rows.
+		if _, err := d.DB.ExecContext(ctx,
+			`DELETE FROM idempotency_keys WHERE expires_at < NOW() LIMIT ?`,
+			idempotencyPurgeBatchSize,
+		); err != nil {
+			slog.ErrorContext(ctx, "idempotency: purge expired keys", logging.Err(err))
+		}
+
+		res, err := d.DB.ExecContext(ctx, `
+			INSERT INTO idempotency_keys (org_id, user_id, idem_key, method, path, request_hash, expires_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, orgID, userID, key, c.Request.Method, c.Request.URL.Path, requestHash, time.Now().Add(ttl))
+		if isDuplicateKey(err) {
+			d.replayIdempotent(c, orgID, userID, key, requestHash)
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to record idempotency key"})
+			return
+		}
+		rowID, err := res.LastInsertId()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to record idempotency key"})
+			return
+		}
+
+		// releaseKey frees the key so the client can retry. Use a fresh
+		// context: the request context may already be cancelled.
+		releaseKey := func() {
+			sctx, cancel := contextWithTimeout(5 * time.Second)
+			defer cancel()
+			if _, err := d.DB.ExecContext(sctx, `DELETE FROM idempotency_keys WHERE id = ?`, rowID); err != nil {
+				slog.ErrorContext(ctx, "idempotency: release key", "key", key, logging.Err(err))
+			}
+		}
+
+		// A panicking handler gets its 500 from gin.Recovery after we've
+		// returned, so release the key on the way out and re-panic.
+		defer func() {
+			if r := recover(); r != nil {
+				releaseKey()
+				panic(r)
+			}
+		}()
+
+		w := &captureWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+
+		c.Next()
+
+		status := w.Status()
+		if status >= http.StatusInternalServerError {
+			releaseKey()
+			return
+		}
+
+		sctx, cancel := contextWithTimeout(5 * time.Second)
+		defer cancel()
+
+		if _, err := d.DB.ExecContext(sctx, `
+			UPDATE idempotency_keys
+			SET status_code = ?, content_type = ?, response_body = ?
+			WHERE id = ?
+		`, status, w.Header().Get("Content-Type"), w.body.Bytes(), rowID); err != nil {
+			slog.ErrorContext(ctx, "idempotency: store response", "key", key, logging.Err(err))
+		}
+	}
+}
+
+// replayIdempotent answers a request whose key already exists.
+func (d *ServerDeps) replayIdempotent(c *gin.Context, orgID, userID int64, key, requestHash string) {
+	var (
+		storedHash  string
+		status      sql.NullInt64
+		contentType sql.NullString
+		body        []byte
+	)
+	err := d.DB.QueryRowContext(c.Request.Context(), `
+		SELECT request_hash, status_code, content_type, response_body
+		FROM idempotency_keys
+		WHERE org_id = ? AND user_id = ? AND idem_key = ?
+	`, orgID, userID, key).Scan(&storedHash, &status, &contentType, &body)
+	if err == sql.ErrNoRows {
+		// The first request failed with a 5xx and released the key in between.
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "request with this Idempotency-Key was retried concurrently; retry again"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to load idempotency key"})
+		return
+	}
+
+	if storedHash != requestHash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+		return
+	}
+	if !status.Valid {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this Idempotency-Key is still in progress"})
+		return
+	}
+
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Data(int(status.Int64), contentType.String, body)
+	c.Abort()
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// idemStore is an in-memory idempotency_keys table behind a database/sql
+// driver that understands just the statements Idempotency issues.
+type idemStore struct {
+	mu     sync.Mutex
+	nextID int64
+	rows   map[int64]*idemRow
+}
+
+type idemRow struct {
+	orgID, userID int64
+	key, hash     string
+	status        any // nil while in flight, else int64
+	contentType   any
+	body          []byte
+}
+
+func (s *idemStore) Connect(context.Context) (driver.Conn, error) { return idemConn{s}, nil }
+func (s *idemStore) Driver() driver.Driver                        { return nil }
+
+type idemConn struct{ s *idemStore }
+
+func (idemConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (idemConn) Close() error                        { return nil }
+func (idemConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c idemConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch q := strings.Join(strings.Fields(query), " "); {
+	case strings.HasPrefix(q, "DELETE FROM idempotency_keys WHERE expires_at"):
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(q, "INSERT INTO idempotency_keys (org_id, user_id, idem_key,"):
+		r := &idemRow{orgID: args[0].Value.(int64), userID: args[1].Value.(int64), key: args[2].Value.(string), hash: args[5].Value.(string)}
+		for _, o := range s.rows {
+			if o.orgID == r.orgID && o.userID == r.userID && o.key == r.key {
+				return nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}
+			}
+		}
+		s.nextID++
+		s.rows[s.nextID] = r
+		return idemResult(s.nextID), nil
+	case strings.HasPrefix(q, "DELETE FROM idempotency_keys WHERE id = ?"):
+		delete(s.rows, args[0].Value.(int64))
+		return driver.RowsAffected(1), nil
+	case strings.HasPrefix(q, "UPDATE idempotency_keys SET status_code"):
+		r := s.rows[args[3].Value.(int64)]
+		r.status, r.contentType, r.body = args[0].Value, args[1].Value, args[2].Value.([]byte)
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected exec: %s", query)
+}
+
+func (c idemConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s := c.s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !strings.Contains(query, "WHERE org_id = ? AND user_id = ? AND idem_key = ?") {
+		return nil, fmt.Errorf("unexpected query: %s", query)
+	}
+	rows := &idemRows{}
+	for _, r := range s.rows {
+		if r.orgID == args[0].Value.(int64) && r.userID == args[1].Value.(int64) && r.key == args[2].Value.(string) {
+			rows.values = append(rows.values, []driver.Value{r.hash, r.status, r.contentType, r.body})
+		}
+	}
+	return rows, nil
+}
+
+type idemResult int64
+
+func (r idemResult) LastInsertId() (int64, error) { return int64(r), nil }
+func (r idemResult) RowsAffected() (int64, error) { return 1, nil }
+
+type idemRows struct{ values [][]driver.Value }
+
+func (*idemRows) Columns() []string {
+	return []string{"request_hash", "status_code", "content_type", "response_body"}
+}
+func (*idemRows) Close() error { return nil }
+func (r *idemRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// idempotencyRouter serves POST /things through Idempotency, acting as the
+// user named by the X-User header (user 1 by default) in org 1. handle is the
+// handler; calls counts how often it ran.
+func idempotencyRouter(t *testing.T, handle gin.HandlerFunc) (r *gin.Engine, store *idemStore, calls *int) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store = &idemStore{rows: map[int64]*idemRow{}}
+	db := sql.OpenDB(store)
+	t.Cleanup(func() { db.Close() })
+	d := &ServerDeps{DB: db}
+
+	calls = new(int)
+	r = gin.New()
+	r.Use(gin.Recovery(), func(c *gin.Context) {
+		userID := int64(1)
+		if v := c.GetHeader("X-User"); v != "" {
+			userID, _ = strconv.ParseInt(v, 10, 64)
+		}
+		c.Set(callerOrgIDKey, int64(1))
+		c.Set(callerUserIDKey, userID)
+	}, d.Idempotency())
+	r.POST("/things", func(c *gin.Context) {
+		*calls++
+		handle(c)
+	})
+	return r, store, calls
+}
+
+func post(r http.Handler, key, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/things", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func created(c *gin.Context) {
+	c.JSON(http.StatusCreated, gin.H{"id": 7})
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	r, _, calls := idempotencyRouter(t, created)
+
+	first := post(r, "k1", `{"name":"web"}`)
+	second := post(r, "k1", `{"name":"web"}`)
+
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want 1", *calls)
+	}
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("status = %d, %d; want 201 twice", first.Code, second.Code)
+	}
+	if second.Body.String() != first.Body.String() || second.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Errorf("replay = %q (%s), want %q (%s)", second.Body, second.Header().Get("Content-Type"), first.Body, first.Header().Get("Content-Type"))
+	}
+	if first.Header().Get(IdempotentReplayedHeader) != "" || second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("%s = %q, %q; want only the replay marked", IdempotentReplayedHeader,
+			first.Header().Get(IdempotentReplayedHeader), second.Header().Get(IdempotentReplayedHeader))
+	}
+}
+
+func TestIdempotencyKeyReusedForAnotherRequest(t *testing.T) {
+	r, _, calls := idempotencyRouter(t, created)
+
+	post(r, "k1", `{"name":"web"}`)
+	w := post(r, "k1", `{"name":"api"}`)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", w.Code)
+	}
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want 1", *calls)
+	}
+}
+
+func TestIdempotencyRepeatWhileInFlight(t *testing.T) {
+	var (
+		r      *gin.Engine
+		repeat *httptest.ResponseRecorder
+	)
+	r, _, calls := idempotencyRouter(t, func(c *gin.Context) {
+		if repeat == nil {
+			repeat = post(r, "k1", `{"name":"web"}`)
+		}
+		created(c)
+	})
+
+	first := post(r, "k1", `{"name":"web"}`)
+
+	if first.Code != http.StatusCreated {
+		t.Errorf("first status = %d, want 201", first.Code)
+	}
+	if repeat.Code != http.StatusConflict {
+		t.Errorf("repeat status = %d, want 409", repeat.Code)
+	}
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want 1", *calls)
+	}
+}
+
+func TestIdempotencyReleasesKeyOnFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		fail gin.HandlerFunc
+	}{
+		{"5xx", func(c *gin.Context) { c.JSON(http.StatusBadGateway, gin.H{"error": "upstream"}) }},
+		{"panic", func(c *gin.Context) { panic("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := true
+			r, store, calls := idempotencyRouter(t, func(c *gin.Context) {
+				if failing {
+					tt.fail(c)
+					return
+				}
+				created(c)
+			})
+
+			if w := post(r, "k1", `{}`); w.Code < 500 {
+				t.Fatalf("first status = %d, want a 5xx", w.Code)
+			}
+			if len(store.rows) != 0 {
+				t.Fatalf("%d keys left after the failure, want 0", len(store.rows))
+			}
+
+			failing = false
+			w := post(r, "k1", `{}`)
+			if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+				t.Errorf("retry status = %d (replayed %q), want a fresh 201", w.Code, w.Header().Get(IdempotentReplayedHeader))
+			}
+			if *calls != 2 {
+				t.Errorf("handler ran %d times, want 2", *calls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyKeepsClientErrors(t *testing.T) {
+	r, _, calls := idempotencyRouter(t, func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+	})
+
+	post(r, "k1", `{}`)
+	w := post(r, "k1", `{}`)
+
+	if w.Code != http.StatusBadRequest || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("status = %d (replayed %q), want a replayed 400", w.Code, w.Header().Get(IdempotentReplayedHeader))
+	}
+	if *calls != 1 {
+		t.Errorf("handler ran %d times, want 1", *calls)
+	}
+}
+
+func TestIdempotencyKeysAreScopedByUser(t *testing.T) {
+	r, _, calls := idempotencyRouter(t, created)
+
+	post(r, "k1", `{"name":"web"}`, "X-User", "1")
+	w := post(r, "k1", `{"name":"api"}`, "X-User", "2")
+
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Errorf("other user's status = %d (replayed %q), want a fresh 201", w.Code, w.Header().Get(IdempotentReplayedHeader))
+	}
+	if *calls != 2 {
+		t.Errorf("handler ran %d times, want 2", *calls)
+	}
+}
+
+func TestIdempotencyWithoutKey(t *testing.T) {
+	r, store, calls := idempotencyRouter(t, created)
+
+	post(r, "", `{}`)
+	post(r, "", `{}`)
+
+	if *calls != 2 || len(store.rows) != 0 {
+		t.Errorf("handler ran %d times with %d keys stored, want 2 and 0", *calls, len(store.rows))
+	}
+	if w := post(r, strings.Repeat("k", maxIdempotencyKeyLength+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("overlong key: status = %d, want 400", w.Code)
+	}
+}
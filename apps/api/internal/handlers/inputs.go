@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inputSpec is how a blueprint's schema.yaml describes one input (a subset of
+// JSON Schema).
+type inputSpec struct {
+	Type                 string     `yaml:"type"` // string, integer, number, boolean, object or array
+	Pattern              string     `yaml:"pattern"`
+	Enum                 []any      `yaml:"enum"`
+	Minimum              *float64   `yaml:"minimum"`
+	Maximum              *float64   `yaml:"maximum"`
+	Default              any        `yaml:"default"`
+	AdditionalProperties *inputSpec `yaml:"additionalProperties"` // objects: spec of every value
+}
+
+// validateInputs checks inputs against the blueprint's declared inputs and
+// returns a description of each problem, sorted. Blueprints that declare no
+// inputs accept anything.
+func validateInputs(specs map[string]inputSpec, inputs map[string]any) []string {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	var problems []string
+	for name, v := range inputs {
+		spec, ok := specs[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: unknown input", name))
+			continue
+		}
+		problems = append(problems, spec.check(name, v)...)
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// checkInputs validates inputs against the schema of blueprint key@version.
+// If they're invalid (or the schema can't be read) it writes the error
+// response and returns false.
+func (d *ServerDeps) checkInputs(c *gin.Context, key, version string, inputs map[string]any) bool {
+	schema, err := d.loadBlueprintSchema(key, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load blueprint schema: " + err.Error()})
+		return false
+	}
+	if schema == nil {
+		return true
+	}
+	if problems := validateInputs(schema.Inputs, inputs); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":         "invalid inputs for " + key + "@" + version,
+			"invalidInputs": problems,
+		})
+		return false
+	}
+	return true
+}
+
+// check validates one (JSON-decoded) value against the spec.
+func (s inputSpec) check(name string, v any) []string {
+	if v == nil {
+		return nil // unset; terraform uses the variable's default
+	}
+
+	switch s.Type {
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{name + ": must be a string"}
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return []string{fmt.Sprintf("%s: blueprint declares an invalid pattern %q", name, s.Pattern)}
+			}
+			if !re.MatchString(str) {
+				return []string{fmt.Sprintf("%s: must match %s", name, s.Pattern)}
+			}
+		}
+	case "integer", "number":
+		n, ok := v.(float64)
+		if !ok || (s.Type == "integer" && n != math.Trunc(n)) {
+			return []string{name + ": must be an " + s.Type}
+		}
+		if s.Minimum != nil && n < *s.Minimum {
+			return []string{fmt.Sprintf("%s: must be at least %v", name, *s.Minimum)}
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			return []string{fmt.Sprintf("%s: must be at most %v", name, *s.Maximum)}
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{name + ": must be a boolean"}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []string{name + ": must be an object"}
+		}
+		if s.AdditionalProperties != nil {
+			var problems []string
+			for k, val := range obj {
+				problems = append(problems, s.AdditionalProperties.check(name+"."+k, val)...)
+			}
+			return problems
+		}
+	case "array":
+		if _, ok := v.([]any); !ok {
+			return []string{name + ": must be an array"}
+		}
+	}
+
+	if len(s.Enum) > 0 && !enumContains(s.Enum, v) {
+		return []string{fmt.Sprintf("%s: must be one of %v", name, s.Enum)}
+	}
+	return nil
+}
+
+// enumContains compares a JSON-decoded value with YAML-decoded enum values,
+// whose numbers come back as ints rather than float64.
+func enumContains(enum []any, v any) bool {
+	for _, e := range enum {
+		switch n := e.(type) {
+		case int:
+			e = float64(n)
+		case int64:
+			e = float64(n)
+		case uint64:
+			e = float64(n)
+		}
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeInputs applies patch to inputs as a JSON merge patch (RFC 7396):
+// objects merge key by key, null removes a key, anything else replaces it.
+// inputs is not modified.
+func mergeInputs(inputs, patch map[string]any) map[string]any {
+	out := make(map[string]any, len(inputs)+len(patch))
+	for k, v := range inputs {
+		out[k] = v
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		sub, isObj := v.(map[string]any)
+		cur, curObj := out[k].(map[string]any)
+		if isObj && curObj {
+			out[k] = mergeInputs(cur, sub)
+			continue
+		}
+		if isObj {
+			out[k] = mergeInputs(nil, sub) // drop nulls
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// InputChange is one input that differs between two revisions.
+type InputChange struct {
+	Input  string `json:"input"`
+	Change string `json:"change"` // "added", "changed" or "removed"
+	From   any    `json:"from,omitempty"`
+	To     any    `json:"to,omitempty"`
+}
+
+// diffInputs lists the inputs that differ from before to after, by name, with
+// sensitive values redacted.
+func diffInputs(before, after map[string]any) []InputChange {
+	changes := []InputChange{}
+	redact := func(name string, v any) any {
+		if v == nil {
+			return nil
+		}
+		return redactInputs(map[string]any{name: v}).(map[string]any)[name]
+	}
+
+	for name, to := range after {
+		from, had := before[name]
+		switch {
+		case !had:
+			changes = append(changes, InputChange{Input: name, Change: "added", To: redact(name, to)})
+		case !reflect.DeepEqual(from, to):
+			changes = append(changes, InputChange{Input: name, Change: "changed", From: redact(name, from), To: redact(name, to)})
+		}
+	}
+	for name, from := range before {
+		if _, has := after[name]; !has {
+			changes = append(changes, InputChange{Input: name, Change: "removed", From: redact(name, from)})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Input < changes[j].Input })
+	return changes
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/your-org/aws-infra-platform/apps/api/internal/metrics"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+	"github.com/your-org/aws-infra-platform/packages/platform/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// awsConnection is the subset of an aws_connections row needed to run jobs.
+type awsConnection struct {
+	ID         int64
+	OrgID      int64
+	AccountID  string
+	RoleArn    string
+	ExternalID string
+	Region     string
+	Status     string
+
+	// PendingExternalID is set while an external ID rotation awaits verification.
+	PendingExternalID string
+
+	// How the worker obtains credentials; see credential_providers.go.
+	CredentialProvider string
+	HubRoleArn         string
+	HubExternalID      string
+	STSEndpoint        string
+}
+
+// awsConnectionColumns is the SELECT list scanned by scanAWSConnection; it
+// expects aws_connections to be aliased as c.
+const awsConnectionColumns = `c.id, c.org_id, c.account_id, c.role_arn, c.external_id, c.region, c.status,
+	COALESCE(c.pending_external_id, ''), c.credential_provider,
+	COALESCE(c.hub_role_arn, ''), COALESCE(c.hub_external_id, ''), COALESCE(c.sts_endpoint, '')`
+
+// scanAWSConnection scans awsConnectionColumns followed by any extra columns.
+func scanAWSConnection(row rowScanner, extra ...any) (*awsConnection, error) {
+	var conn awsConnection
+	dest := []any{
+		&conn.ID,
+		&conn.OrgID,
+		&conn.AccountID,
+		&conn.RoleArn,
+		&conn.ExternalID,
+		&conn.Region,
+		&conn.Status,
+		&conn.PendingExternalID,
+		&conn.CredentialProvider,
+		&conn.HubRoleArn,
+		&conn.HubExternalID,
+		&conn.STSEndpoint,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &conn, nil
+}
+
+// loadAWSConnection loads a connection owned by orgID, or returns
+// sql.ErrNoRows.
+func loadAWSConnection(ctx context.Context, q querier, connID, orgID int64) (*awsConnection, error) {
+	return scanAWSConnection(q.QueryRowContext(ctx, `
+		SELECT `+awsConnectionColumns+`
+		FROM aws_connections c
+		WHERE c.id = ? AND c.org_id = ?
+	`, connID, orgID))
+}
+
+// loadDeploymentConnection resolves the connection a deployment is bound to,
+// with Region replaced by the deployment's own region override if it has one.
+// It returns sql.ErrNoRows if the deployment has no binding.
+func loadDeploymentConnection(ctx context.Context, q querier, deploymentID int64) (*awsConnection, error) {
+	var region sql.NullString
+	conn, err := scanAWSConnection(q.QueryRowContext(ctx, `
+		SELECT `+awsConnectionColumns+`, dep.region
+		FROM deployments dep
+		JOIN aws_connections c ON c.id = dep.aws_connection_id
+		WHERE dep.id = ?
+	`, deploymentID), &region)
+	if err != nil {
+		return nil, err
+	}
+	if region.Valid && region.String != "" {
+		conn.Region = region.String
+	}
+	return conn, nil
+}
+
+// runJob rebuilds the job for an existing run from its deployment, for runs
+// that are enqueued after the request that created them (fan-out dispatch).
+// The connection is returned so callers can check it is still usable.
+func runJob(ctx context.Context, q querier, runID int64) (jobs.Job, *awsConnection, error) {
+	var (
+		action       string
+		deploymentID int64
+	)
+	err := q.QueryRowContext(ctx,
+		`SELECT action, deployment_id FROM runs WHERE id = ?`, runID,
+	).Scan(&action, &deploymentID)
+	if err != nil {
+		return jobs.Job{}, nil, err
+	}
+
+	job, conn, err := deploymentJob(ctx, q, deploymentID, action)
+	job.RunID = runID
+	return job, conn, err
+}
+
+// deploymentJob builds a job (without a RunID) for running action on a
+// deployment with its stored blueprint, inputs and connection. It returns
+// sql.ErrNoRows if the deployment doesn't exist or has no connection.
+func deploymentJob(ctx context.Context, q querier, deploymentID int64, action string) (jobs.Job, *awsConnection, error) {
+	job := jobs.Job{Action: action}
+	var inputsJSON string
+	err := q.QueryRowContext(ctx, `
+		SELECT b.blueprint_key, b.version, dep.inputs_json
+		FROM deployments dep
+		JOIN blueprints b ON b.id = dep.blueprint_id
+		WHERE dep.id = ?
+	`, deploymentID).Scan(&job.BlueprintKey, &job.Version, &inputsJSON)
+	if err != nil {
+		return job, nil, err
+	}
+	if err := json.Unmarshal([]byte(inputsJSON), &job.Inputs); err != nil {
+		return job, nil, fmt.Errorf("decode inputs: %w", err)
+	}
+
+	conn, err := loadDeploymentConnection(ctx, q, deploymentID)
+	if err != nil {
+		return job, nil, err
+	}
+	job.AWS = conn.jobAWS()
+	return job, conn, nil
+}
+
+// usable reports whether runs may be started with this connection.
+func (conn *awsConnection) usable() bool {
+	return conn.Status == "active"
+}
+
+// jobAWS is the "aws" block of a job payload.
+func (conn *awsConnection) jobAWS() jobs.AWSTarget {
+	return jobs.AWSTarget{
+		RoleArn:            conn.RoleArn,
+		ExternalID:         conn.ExternalID,
+		Region:             conn.Region,
+		CredentialProvider: conn.CredentialProvider,
+		HubRoleArn:         conn.HubRoleArn,
+		HubExternalID:      conn.HubExternalID,
+		STSEndpoint:        conn.STSEndpoint,
+	}
+}
+
+// enqueueJob pushes a job onto the worker queue. An apply whose environment
+// requires approvals is sent as its plan step (see approvals.go), and the
+// job carries the blueprint's timeout for what it runs and the trace context
+// of the enqueue span.
+func (d *ServerDeps) enqueueJob(ctx context.Context, job jobs.Job) (err error) {
+	ctx, span := tracing.Tracer("api").Start(ctx, jobs.Queue+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.destination.name", jobs.Queue),
+			attribute.Int64("aip.run_id", job.RunID),
+			attribute.String("aip.action", job.Action),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "enqueue failed")
+		}
+		span.End()
+	}()
+
+	if job.Action == jobs.ActionApply && job.Step == "" {
+		required, err := d.gateApply(ctx, job.RunID)
+		if err != nil {
+			return fmt.Errorf("resolve required approvals: %w", err)
+		}
+		if required > 0 {
+			job.Step = jobs.StepPlanForApproval
+		}
+	}
+
+	timeout, err := d.blueprintTimeout(job)
+	if err != nil {
+		return err
+	}
+	job.TimeoutSeconds = int(timeout / time.Second)
+	job.EnqueuedAt = time.Now().UTC()
+	job.RequestID = logging.RequestID(ctx)
+	tracing.InjectJob(ctx, &job)
+	span.SetAttributes(attribute.String("aip.step", job.Step))
+
+	payload, err := jobs.Encode(job)
+	if err != nil {
+		return fmt.Errorf("encode job: %w", err)
+	}
+	if err := d.RDB.RPush(ctx, jobs.Queue, payload).Err(); err != nil {
+		return fmt.Errorf("enqueue job: %w", err)
+	}
+	metrics.RunEnqueued(job)
+	slog.InfoContext(logging.WithRun(ctx, job.RunID), "job enqueued",
+		"action", job.Action, "step", job.Step, "blueprint", job.BlueprintKey+"@"+job.Version)
+	return nil
+}
+
+var (
+	errRunInProgress      = errors.New("deployment has a run in progress")
+	errNotDeployed        = errors.New("deployment has no applied resources")
+	errConnectionUnusable = errors.New("deployment's connection is not active")
+	errRevisionConflict   = errors.New("deployment was revised concurrently; retry against its current revision")
+)
+
+// startDeploymentRun inserts and enqueues a run of action for an existing
+// deployment. The deployment row is locked so two callers can't both pass the
+// in-progress check. Drift and destroy runs need applied resources.
+// triggeredBy is nil for runs the platform starts itself.
+func (d *ServerDeps) startDeploymentRun(ctx context.Context, deploymentID int64, action string, triggeredBy *int64) (int64, error) {
+	runID, _, err := d.startRevisedRun(ctx, deploymentID, nil, action, triggeredBy)
+	return runID, err
+}
+
+// startRevisedRun is startDeploymentRun that first makes change (unless nil)
+// the deployment's current revision, under the same lock and checks. It also
+// returns the number of the revision created, or 0.
+func (d *ServerDeps) startRevisedRun(ctx context.Context, deploymentID int64, change *revisionChange, action string, triggeredBy *int64) (int64, int, error) {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var deployed bool
+	if err := tx.QueryRowContext(ctx, `
+		SELECT `+deployedRunsCondition+`
+		FROM deployments dep
+		WHERE dep.id = ?
+		FOR UPDATE
+	`, deploymentID).Scan(&deployed); err != nil {
+		return 0, 0, fmt.Errorf("lock deployment: %w", err)
+	}
+	if !deployed && (action == jobs.ActionDrift || action == jobs.ActionDestroy) {
+		return 0, 0, errNotDeployed
+	}
+
+	var active int
+	if err := tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM runs
+		WHERE deployment_id = ? AND status IN ('pending', 'queued', 'running', 'awaiting_approval')
+	`, deploymentID).Scan(&active); err != nil {
+		return 0, 0, err
+	}
+	if active > 0 {
+		return 0, 0, errRunInProgress
+	}
+
+	revision := 0
+	var rollbackOf *int64
+	if change != nil {
+		if change.BaseRevisionID > 0 {
+			var current int64
+			if err := tx.QueryRowContext(ctx, `SELECT `+currentRevisionSQL, deploymentID).Scan(&current); err != nil {
+				return 0, 0, fmt.Errorf("load current revision: %w", err)
+			}
+			if current != change.BaseRevisionID {
+				return 0, 0, errRevisionConflict
+			}
+		}
+		if _, revision, err = insertRevision(ctx, tx, deploymentID, change.BlueprintID, change.InputsJSON, change.Source, triggeredBy); err != nil {
+			return 0, 0, fmt.Errorf("insert revision: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE deployments SET blueprint_id = ?, inputs_json = ? WHERE id = ?`,
+			change.BlueprintID, change.InputsJSON, deploymentID,
+		); err != nil {
+			return 0, 0, fmt.Errorf("update deployment: %w", err)
+		}
+		rollbackOf = change.RollbackOfRunID
+	}
+
+	job, conn, err := deploymentJob(ctx, tx, deploymentID, action)
+	if err == sql.ErrNoRows {
+		return 0, 0, errConnectionUnusable
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("build job: %w", err)
+	}
+	if !conn.usable() {
+		return 0, 0, errConnectionUnusable
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO runs (deployment_id, action, status, triggered_by, revision_id, rollback_of_run_id)
+		VALUES (?, ?, 'queued', ?, `+currentRevisionSQL+`, ?)
+	`, deploymentID, action, triggeredBy, deploymentID, rollbackOf)
+	if err != nil {
+		return 0, 0, fmt.Errorf("insert run: %w", err)
+	}
+	if job.RunID, err = res.LastInsertId(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	if err := d.enqueueJob(context.WithoutCancel(ctx), job); err != nil {
+		// Don't leave it queued forever; the caller's next pass retries.
+		if _, err2 := d.DB.ExecContext(context.Background(), `
+			UPDATE runs SET status = 'failed', summary = ?, finished_at = NOW() WHERE id = ?
+		`, "not started: "+err.Error(), job.RunID); err2 != nil {
+			slog.ErrorContext(logging.WithRun(ctx, job.RunID), "mark run failed", logging.Err(err2))
+		}
+		return 0, 0, fmt.Errorf("enqueue: %w", err)
+	}
+	return job.RunID, revision, nil
+}
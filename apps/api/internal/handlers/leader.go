@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+const (
+	// DefaultLeaderCheckInterval is how often an instance tries to take, or
+	// confirms it still holds, the leader lock.
+	DefaultLeaderCheckInterval = 10 * time.Second
+
+	// leaderLockName is the MySQL named lock (GET_LOCK) held by the leader.
+	leaderLockName = "aip:leader"
+)
+
+// RunLeaderElection makes at most one API instance the leader: the one
+// holding leaderLockName on a dedicated MySQL connection. MySQL releases the
+// lock if that connection dies, so another instance takes over within one
+// interval. Timer-driven work that creates runs (schedules, drift checks,
+// expiries) only happens on the leader. An interval <= 0 skips the election
+// and makes this instance the leader, for single-instance setups.
+func (d *ServerDeps) RunLeaderElection(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.InfoContext(ctx, "leader election disabled; this instance always leads")
+		d.leader.Store(true)
+		return
+	}
+
+	var conn *sql.Conn
+	defer func() {
+		d.leader.Store(false)
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		held, err := d.holdLeaderLock(ctx, &conn)
+		if err != nil {
+			slog.ErrorContext(ctx, "leader election", logging.Err(err))
+			if conn != nil {
+				conn.Close()
+				conn = nil
+			}
+		}
+		if held != d.leader.Load() {
+			if held {
+				slog.InfoContext(ctx, "leader election: this instance is now the leader")
+			} else {
+				slog.WarnContext(ctx, "leader election: lost leadership")
+			}
+			d.leader.Store(held)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// holdLeaderLock confirms *conn still holds the lock, or tries to take it
+// (opening *conn if needed) without waiting.
+func (d *ServerDeps) holdLeaderLock(ctx context.Context, conn **sql.Conn) (bool, error) {
+	if *conn == nil {
+		c, err := d.DB.Conn(ctx)
+		if err != nil {
+			return false, err
+		}
+		*conn = c
+	}
+
+	var held sql.NullBool
+	if err := (*conn).QueryRowContext(ctx,
+		`SELECT IS_USED_LOCK(?) = CONNECTION_ID()`, leaderLockName,
+	).Scan(&held); err != nil {
+		return false, err
+	}
+	if held.Valid && held.Bool {
+		return true, nil
+	}
+
+	var got sql.NullInt64
+	if err := (*conn).QueryRowContext(ctx,
+		`SELECT GET_LOCK(?, 0)`, leaderLockName,
+	).Scan(&got); err != nil {
+		return false, err
+	}
+	return got.Valid && got.Int64 == 1, nil
+}
+
+// isLeader reports whether this instance currently holds the leader lock.
+func (d *ServerDeps) isLeader() bool {
+	return d.leader.Load()
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/awsutil"
+)
+
+// ConnectionSetup is what a user needs to create the deploy role's trust
+// policy in their account: either snippet can be applied as-is. Providers
+// that don't use an STS trust on a principal get a Note instead.
+type ConnectionSetup struct {
+	PlatformPrincipal string   `json:"platformPrincipal"`
+	ExternalIDs       []string `json:"externalIds,omitempty"`
+	Terraform         string   `json:"terraform,omitempty"`
+	CloudFormation    string   `json:"cloudFormation,omitempty"`
+	Note              string   `json:"note,omitempty"`
+}
+
+// generateExternalID returns an unguessable external ID (128 bits of entropy).
+func generateExternalID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "aip-" + hex.EncodeToString(b), nil
+}
+
+// splitRoleArn returns the IAM path ("/" by default) and role name of a role ARN.
+func splitRoleArn(roleArn string) (path, name string) {
+	resource := roleArn[strings.Index(roleArn, ":role/")+len(":role/"):]
+	i := strings.LastIndex(resource, "/")
+	if i < 0 {
+		return "/", resource
+	}
+	return "/" + resource[:i+1], resource[i+1:]
+}
+
+var terraformTrustTmpl = template.Must(template.New("tf").Parse(`# Deploy role for AWS Infra Platform.
+# Attach the permissions your blueprints need (ECS, EC2, IAM PassRole, ...) to this role,
+# plus iam:SimulatePrincipalPolicy on the role itself for pre-flight permission checks.
+resource "aws_iam_role" "aip_deploy" {
+  name = "{{.RoleName}}"
+  path = "{{.RolePath}}"
+
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect    = "Allow"
+        Principal = { AWS = "{{.Principal}}" }
+        Action    = "sts:AssumeRole"
+        Condition = {
+          StringEquals = {
+            "sts:ExternalId" = {{if eq (len .ExternalIDs) 1}}"{{index .ExternalIDs 0}}"{{else}}[{{range $i, $id := .ExternalIDs}}{{if $i}}, {{end}}"{{$id}}"{{end}}]{{end}}
+          }
+        }
+      }
+    ]
+  })
+}
+`))
+
+var cloudFormationTrustTmpl = template.Must(template.New("cfn").Parse(`AWSTemplateFormatVersion: "2010-09-09"
+Description: Deploy role for AWS Infra Platform
+Resources:
+  AipDeployRole:
+    Type: AWS::IAM::Role
+    Properties:
+      RoleName: {{.RoleName}}
+      Path: {{.RolePath}}
+      AssumeRolePolicyDocument:
+        Version: "2012-10-17"
+        Statement:
+          - Effect: Allow
+            Principal:
+              AWS: {{.Principal}}
+            Action: sts:AssumeRole
+            Condition:
+              StringEquals:
+                sts:ExternalId:{{range .ExternalIDs}}
+                  - {{.}}{{end}}
+      # Add ManagedPolicyArns / Policies with the permissions your blueprints need,
+      # plus iam:SimulatePrincipalPolicy on this role for pre-flight permission checks.
+Outputs:
+  RoleArn:
+    Value: !GetAtt AipDeployRole.Arn
+`))
+
+// errNoPlatformPrincipal means the trust policy can't be rendered because
+// the platform principal couldn't be resolved at startup (set
+// PLATFORM_PRINCIPAL_ARN).
+var errNoPlatformPrincipal = errors.New("platform principal is not configured; trust policies can't be generated")
+
+// connectionSetup renders the trust policy snippets for conn's role, which
+// must accept every ID in externalIDs.
+func (d *ServerDeps) connectionSetup(conn *awsConnection, externalIDs []string) (ConnectionSetup, error) {
+	principal := d.trustPrincipal(conn)
+
+	switch conn.CredentialProvider {
+	case awsutil.ProviderWebIdentity:
+		return ConnectionSetup{
+			PlatformPrincipal: principal,
+			Note:              "The role must trust the worker's OIDC identity provider (sts:AssumeRoleWithWebIdentity); external IDs do not apply. The platform can't assume the role itself, so the first run confirms the trust policy.",
+		}, nil
+	case awsutil.ProviderStatic:
+		return ConnectionSetup{
+			PlatformPrincipal: principal,
+			Note:              "Runs use the worker's AIP_STATIC_AWS_* keys; no trust policy is needed. For local testing only.",
+		}, nil
+	}
+
+	if principal == "" {
+		return ConnectionSetup{}, errNoPlatformPrincipal
+	}
+
+	rolePath, roleName := splitRoleArn(conn.RoleArn)
+	data := struct {
+		RoleName    string
+		RolePath    string
+		Principal   string
+		ExternalIDs []string
+	}{roleName, rolePath, principal, externalIDs}
+
+	var tf, cfn bytes.Buffer
+	if err := terraformTrustTmpl.Execute(&tf, data); err != nil {
+		return ConnectionSetup{}, err
+	}
+	if err := cloudFormationTrustTmpl.Execute(&cfn, data); err != nil {
+		return ConnectionSetup{}, err
+	}
+
+	return ConnectionSetup{
+		PlatformPrincipal: principal,
+		ExternalIDs:       externalIDs,
+		Terraform:         tf.String(),
+		CloudFormation:    cfn.String(),
+	}, nil
+}
+
+// GET /v1/connections/aws/:id/setup
+// Re-renders the trust policy snippets for a connection, including any
+// external IDs that are mid-rotation.
+func (d *ServerDeps) GetAWSConnectionSetup(c *gin.Context) {
+	connID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid connection id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	conn, err := loadAWSConnection(ctx, d.DB, connID, callerOrgID(c))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "connection not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+
+	resp, err := d.connectionResp(ctx, connID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+
+	setup, err := d.connectionSetup(conn, resp.trustedExternalIDs())
+	if errors.Is(err, errNoPlatformPrincipal) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to render setup snippets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// POST /v1/connections/aws/:id/verify
+// Runs the STS AssumeRole check on demand. Activates a pending connection,
+// restores a failed one, and marks an active one failed if the role can no
+// longer be assumed. While an external ID rotation is pending, it checks the
+// new ID instead and promotes it on success.
+func (d *ServerDeps) VerifyAWSConnection(c *gin.Context) {
+	connID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid connection id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	conn, err := loadAWSConnection(ctx, d.DB, connID, callerOrgID(c))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "connection not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+
+	if conn.PendingExternalID != "" {
+		if err := d.verifyRole(ctx, conn, conn.PendingExternalID); err != nil {
+			// The current ID is untouched and keeps working.
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to assume role with the new external id: " + err.Error()})
+			return
+		}
+		if err := d.promotePendingExternalID(ctx, conn); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to promote external id: " + err.Error()})
+			return
+		}
+		resp, err := d.connectionResp(ctx, connID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	checkErr := d.checkConnection(ctx, conn)
+
+	resp, err := d.connectionResp(ctx, connID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load connection"})
+		return
+	}
+
+	if checkErr != nil && !roleRejected(checkErr) {
+		// Throttling, network trouble etc.: nothing for the user to fix
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "couldn't check the role: " + checkErr.Error(), "connection": resp})
+		return
+	}
+	if checkErr != nil {
+		// Surface as 400 so the user can fix the trust policy and retry.
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to assume role: " + checkErr.Error(), "connection": resp})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
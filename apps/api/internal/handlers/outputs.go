@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OutputSnapshot is the outputs a run left its deployment with: those
+// captured after an apply, or none after a destroy.
+type OutputSnapshot struct {
+	RunID      int64           `json:"runId"`
+	Action     string          `json:"action"`
+	Revision   *int            `json:"revision,omitempty"`
+	FinishedAt *time.Time      `json:"finishedAt,omitempty"`
+	Outputs    json.RawMessage `json:"outputs"` // sensitive values redacted
+
+	// Outputs added, changed or removed since the previous snapshot
+	Changed []string `json:"changed"`
+}
+
+// outputSnapshotSorts are the ?sort= keys accepted by ListDeploymentOutputs.
+var outputSnapshotSorts = map[string]sortField{
+	"runId": {Column: "r.id"},
+}
+
+// GET /v1/deployments/:id/outputs
+// Lists the outputs snapshots of a deployment's applies and destroys, newest
+// first, each with the outputs it changed. Supports cursor pagination
+// (?limit=, ?cursor=) and ?sort=.
+func (d *ServerDeps) ListDeploymentOutputs(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	lp, err := parseListParams(c, outputSnapshotSorts, "-runId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+
+	where := []string{"r.deployment_id = ?", "r.outputs_json IS NOT NULL"}
+	args := []any{deploymentID}
+
+	clause, cargs, err := lp.keyset("r.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT r.id, r.action, rev.revision, r.finished_at, r.outputs_json,
+		       (SELECT prev.outputs_json FROM runs prev
+		        WHERE prev.deployment_id = r.deployment_id AND prev.outputs_json IS NOT NULL AND prev.id < r.id
+		        ORDER BY prev.id DESC
+		        LIMIT 1)
+		FROM runs r
+		LEFT JOIN deployment_revisions rev ON rev.id = r.revision_id
+		WHERE `+strings.Join(where, " AND ")+`
+		`+lp.orderBy("r.id"), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query outputs"})
+		return
+	}
+	defer rows.Close()
+
+	var snapshots []OutputSnapshot
+	for rows.Next() {
+		var (
+			s          OutputSnapshot
+			revision   sql.NullInt64
+			finishedAt sql.NullTime
+			raw        string
+			prev       sql.NullString
+		)
+		if err := rows.Scan(&s.RunID, &s.Action, &revision, &finishedAt, &raw, &prev); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query outputs"})
+			return
+		}
+		if revision.Valid {
+			n := int(revision.Int64)
+			s.Revision = &n
+		}
+		if finishedAt.Valid {
+			t := finishedAt.Time
+			s.FinishedAt = &t
+		}
+		s.Outputs = redactOutputs(json.RawMessage(raw))
+		s.Changed = changedOutputs(json.RawMessage(prev.String), json.RawMessage(raw))
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query outputs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPage(c, lp, snapshots, func(s OutputSnapshot) (any, int64) {
+		return s.RunID, s.RunID
+	}))
+}
+
+// changedOutputs lists the names of outputs (from `terraform output -json`)
+// that differ between before (empty for the first snapshot) and after,
+// sorted. Sensitive outputs are compared too; only their names are reported.
+func changedOutputs(before, after json.RawMessage) []string {
+	var b, a map[string]any
+	_ = json.Unmarshal(before, &b)
+	_ = json.Unmarshal(after, &a)
+
+	changed := []string{}
+	for name, v := range a {
+		if prev, ok := b[name]; !ok || !reflect.DeepEqual(prev, v) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// Page is the response envelope shared by every list endpoint.
+// NextCursor/Next are omitted on the last page.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+}
+
+// sortField describes a column a list endpoint can be sorted by.
+type sortField struct {
+	Column string // SQL expression, e.g. "dep.created_at"; cast ENUMs to CHAR so ORDER BY and the keyset compare alike
+	IsTime bool   // cursor value is a timestamp rather than a string/number
+}
+
+// pageCursor is the opaque keyset position handed out as nextCursor.
+// It records the sort it was issued for so it can't be replayed against
+// a different ordering.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// listParams holds the parsed ?limit=, ?sort= and ?cursor= query parameters.
+type listParams struct {
+	Limit   int
+	SortKey string // as given by the client, e.g. "-createdAt"
+	Name    string // SortKey without the direction prefix
+	Field   sortField
+	Desc    bool
+	Cursor  *pageCursor
+}
+
+// parseListParams reads limit/sort/cursor from the query string. sorts maps
+// the public sort names to columns; defaultSort uses the same "-name" syntax
+// as the query parameter.
+func parseListParams(c *gin.Context, sorts map[string]sortField, defaultSort string) (listParams, error) {
+	p := listParams{Limit: defaultPageLimit}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return p, errors.New("invalid limit")
+		}
+		if n > maxPageLimit {
+			n = maxPageLimit
+		}
+		p.Limit = n
+	}
+
+	p.SortKey = c.DefaultQuery("sort", defaultSort)
+	name := strings.TrimPrefix(p.SortKey, "-")
+	p.Name = name
+	p.Desc = strings.HasPrefix(p.SortKey, "-")
+	field, ok := sorts[name]
+	if !ok {
+		allowed := make([]string, 0, len(sorts))
+		for k := range sorts {
+			allowed = append(allowed, k)
+		}
+		sort.Strings(allowed)
+		return p, fmt.Errorf("invalid sort; allowed: %s (prefix with '-' for descending)", strings.Join(allowed, ", "))
+	}
+	p.Field = field
+
+	if v := c.Query("cursor"); v != "" {
+		cur, err := decodeCursor(v)
+		if err != nil || cur.Sort != p.SortKey {
+			return p, errors.New("invalid cursor")
+		}
+		p.Cursor = cur
+	}
+
+	return p, nil
+}
+
+// keyset returns the WHERE fragment (and its args) that resumes after the
+// cursor position, or "" when there is no cursor. idColumn is the tiebreaker.
+func (p listParams) keyset(idColumn string) (string, []any, error) {
+	if p.Cursor == nil {
+		return "", nil, nil
+	}
+
+	var v any = p.Cursor.Value
+	if p.Field.IsTime {
+		t, err := time.Parse(time.RFC3339Nano, p.Cursor.Value)
+		if err != nil {
+			return "", nil, errors.New("invalid cursor")
+		}
+		v = t
+	}
+
+	op := ">"
+	if p.Desc {
+		op = "<"
+	}
+	clause := fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND %[3]s %[2]s ?))", p.Field.Column, op, idColumn)
+	return clause, []any{v, v, p.Cursor.ID}, nil
+}
+
+// orderBy returns the ORDER BY/LIMIT tail. One extra row is fetched so we
+// know whether another page exists.
+func (p listParams) orderBy(idColumn string) string {
+	dir := "ASC"
+	if p.Desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT %d", p.Field.Column, dir, idColumn, dir, p.Limit+1)
+}
+
+// cursorValue formats a sort value for embedding in a cursor.
+func cursorValue(v any) string {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	case string:
+		return t
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// buildPage trims the look-ahead row and fills in the next cursor/link.
+// key returns the (sort value, id) pair of an item.
+func buildPage[T any](c *gin.Context, p listParams, items []T, key func(T) (any, int64)) Page[T] {
+	if items == nil {
+		items = []T{}
+	}
+	page := Page[T]{Items: items}
+	if len(items) <= p.Limit {
+		return page
+	}
+
+	page.Items = items[:p.Limit]
+	v, id := key(page.Items[p.Limit-1])
+	page.NextCursor = encodeCursor(pageCursor{Sort: p.SortKey, Value: cursorValue(v), ID: id})
+
+	u := *c.Request.URL
+	q := u.Query()
+	q.Set("cursor", page.NextCursor)
+	u.RawQuery = q.Encode()
+	page.Next = u.RequestURI()
+
+	return page
+}
+
+func encodeCursor(cur pageCursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cur pageCursor
+	if err := json.Unmarshal(b, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
+
+// queryTime parses an optional RFC3339 timestamp query parameter.
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s; expected RFC3339", name)
+	}
+	return &t, nil
+}
+
+// queryEnum reads an optional query parameter that must be one of allowed.
+func queryEnum(c *gin.Context, name string, allowed ...string) (string, error) {
+	v := c.Query(name)
+	if v == "" || slices.Contains(allowed, v) {
+		return v, nil
+	}
+	return "", fmt.Errorf("invalid %s; allowed: %s", name, strings.Join(allowed, ", "))
+}
+
+// queryID parses an optional positive integer query parameter.
+func queryID(c *gin.Context, name string) (int64, bool, error) {
+	v := c.Query(name)
+	if v == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false, fmt.Errorf("invalid %s", name)
+	}
+	return id, true, nil
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func testContext(target string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", target, nil)
+	return c
+}
+
+var testSorts = map[string]sortField{
+	"createdAt": {Column: "dep.created_at", IsTime: true},
+	"name":      {Column: "p.name"},
+	"id":        {Column: "dep.id"},
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, cur := range []pageCursor{
+		{Sort: "-createdAt", Value: "2026-10-18T15:04:05.123456789Z", ID: 42},
+		{Sort: "name", Value: "päge/one+two=?&", ID: 1},
+		{Sort: "id", Value: "7", ID: 7},
+	} {
+		s := encodeCursor(cur)
+		got, err := decodeCursor(s)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", s, err)
+		}
+		if *got != cur {
+			t.Errorf("round trip = %+v, want %+v", *got, cur)
+		}
+	}
+
+	for _, s := range []string{"not base64!", "bm90IGpzb24"} { // the latter is "not json"
+		if _, err := decodeCursor(s); err == nil {
+			t.Errorf("decodeCursor(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestParseListParams(t *testing.T) {
+	cursor := encodeCursor(pageCursor{Sort: "-createdAt", Value: "2026-10-18T15:04:05Z", ID: 9})
+
+	tests := []struct {
+		name      string
+		query     string
+		wantErr   bool
+		wantLimit int
+		wantSort  string
+		wantDesc  bool
+		wantCur   bool
+	}{
+		{name: "defaults", query: "", wantLimit: defaultPageLimit, wantSort: "-createdAt", wantDesc: true},
+		{name: "ascending sort", query: "sort=name&limit=10", wantLimit: 10, wantSort: "name"},
+		{name: "limit capped", query: "limit=100000", wantLimit: maxPageLimit, wantSort: "-createdAt", wantDesc: true},
+		{name: "cursor for the same sort", query: "cursor=" + cursor, wantLimit: defaultPageLimit, wantSort: "-createdAt", wantDesc: true, wantCur: true},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "non-numeric limit", query: "limit=ten", wantErr: true},
+		{name: "unknown sort", query: "sort=secret", wantErr: true},
+		{name: "cursor for another sort", query: "sort=createdAt&cursor=" + cursor, wantErr: true},
+		{name: "garbled cursor", query: "cursor=xyz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseListParams(testContext("/v1/deployments?"+tt.query), testSorts, "-createdAt")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseListParams succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseListParams: %v", err)
+			}
+			if p.Limit != tt.wantLimit || p.SortKey != tt.wantSort || p.Desc != tt.wantDesc || (p.Cursor != nil) != tt.wantCur {
+				t.Errorf("params = %+v, want limit %d, sort %q, desc %v, cursor %v", p, tt.wantLimit, tt.wantSort, tt.wantDesc, tt.wantCur)
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	created := time.Date(2026, 10, 18, 15, 4, 5, 123456789, time.UTC)
+
+	tests := []struct {
+		name       string
+		params     listParams
+		wantClause string
+		wantArgs   []any
+		wantErr    bool
+	}{
+		{
+			name:   "no cursor",
+			params: listParams{Field: testSorts["name"]},
+		},
+		{
+			name:       "time, descending",
+			params:     listParams{Field: testSorts["createdAt"], Desc: true, Cursor: &pageCursor{Value: created.Format(time.RFC3339Nano), ID: 9}},
+			wantClause: "(dep.created_at < ? OR (dep.created_at = ? AND dep.id < ?))",
+			wantArgs:   []any{created, created, int64(9)},
+		},
+		{
+			name:       "string, ascending",
+			params:     listParams{Field: testSorts["name"], Cursor: &pageCursor{Value: "web", ID: 3}},
+			wantClause: "(p.name > ? OR (p.name = ? AND dep.id > ?))",
+			wantArgs:   []any{"web", "web", int64(3)},
+		},
+		{
+			name:       "id: the tie-break never decides",
+			params:     listParams{Field: testSorts["id"], Desc: true, Cursor: &pageCursor{Value: "7", ID: 7}},
+			wantClause: "(dep.id < ? OR (dep.id = ? AND dep.id < ?))",
+			wantArgs:   []any{"7", "7", int64(7)},
+		},
+		{
+			name:    "time cursor with a bad timestamp",
+			params:  listParams{Field: testSorts["createdAt"], Cursor: &pageCursor{Value: "yesterday", ID: 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clause, args, err := tt.params.keyset("dep.id")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("keyset succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("keyset: %v", err)
+			}
+			if clause != tt.wantClause {
+				t.Errorf("clause = %q, want %q", clause, tt.wantClause)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	tests := []struct {
+		params listParams
+		want   string
+	}{
+		{listParams{Field: testSorts["createdAt"], Desc: true, Limit: 50}, "ORDER BY dep.created_at DESC, dep.id DESC LIMIT 51"},
+		{listParams{Field: testSorts["name"], Limit: 10}, "ORDER BY p.name ASC, dep.id ASC LIMIT 11"},
+		{listParams{Field: testSorts["id"], Limit: 1}, "ORDER BY dep.id ASC, dep.id ASC LIMIT 2"},
+	}
+	for _, tt := range tests {
+		if got := tt.params.orderBy("dep.id"); got != tt.want {
+			t.Errorf("orderBy = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestBuildPage(t *testing.T) {
+	type item struct {
+		ID      int64
+		Created time.Time
+	}
+	base := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	rows := func(n int) []item {
+		var items []item
+		for i := range n {
+			items = append(items, item{ID: int64(n - i), Created: base.Add(-time.Duration(i) * time.Hour)})
+		}
+		return items
+	}
+	key := func(it item) (any, int64) { return it.Created, it.ID }
+	p := listParams{Limit: 2, SortKey: "-createdAt", Desc: true, Field: testSorts["createdAt"]}
+
+	tests := []struct {
+		name     string
+		rows     int // as fetched with LIMIT p.Limit+1
+		wantLen  int
+		wantNext bool
+	}{
+		{"empty", 0, 0, false},
+		{"short page", 1, 1, false},
+		{"exactly a page", 2, 2, false},
+		{"look-ahead row present", 3, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testContext("/v1/deployments?status=applied&sort=-createdAt")
+			page := buildPage(c, p, rows(tt.rows), key)
+
+			if page.Items == nil || len(page.Items) != tt.wantLen {
+				t.Fatalf("items = %v, want %d non-nil", page.Items, tt.wantLen)
+			}
+			if (page.NextCursor != "") != tt.wantNext {
+				t.Fatalf("nextCursor = %q, want one: %v", page.NextCursor, tt.wantNext)
+			}
+			if !tt.wantNext {
+				return
+			}
+
+			cur, err := decodeCursor(page.NextCursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := page.Items[len(page.Items)-1]
+			want := pageCursor{Sort: "-createdAt", Value: last.Created.Format(time.RFC3339Nano), ID: last.ID}
+			if *cur != want {
+				t.Errorf("cursor = %+v, want %+v", *cur, want)
+			}
+
+			// The next link keeps the other parameters.
+			next := testContext(page.Next)
+			if next.Query("status") != "applied" || next.Query("cursor") != page.NextCursor {
+				t.Errorf("next = %q", page.Next)
+			}
+			if _, err := parseListParams(next, testSorts, "-createdAt"); err != nil {
+				t.Errorf("next link's cursor rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryEnum(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"status=applied", "applied", false},
+		{"status=Applied", "", true},
+		{"status=applied'--", "", true},
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			got, err := queryEnum(testContext("/v1/deployments?"+tt.query), "status", deploymentStatuses...)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("queryEnum(%q) = %q, %v; want %q (error: %v)", tt.query, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/awsutil"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// Permission is one IAM action a blueprint needs, optionally on a specific
+// resource ARN (empty means any resource).
+type Permission struct {
+	Action   string `yaml:"action"`
+	Resource string `yaml:"resource"`
+}
+
+// UnmarshalYAML accepts either a bare action name or {action, resource}.
+func (p *Permission) UnmarshalYAML(unmarshal func(any) error) error {
+	var action string
+	if err := unmarshal(&action); err == nil {
+		*p = Permission{Action: action}
+		return nil
+	}
+	type plain Permission
+	return unmarshal((*plain)(p))
+}
+
+func (p Permission) String() string {
+	if p.Resource == "" {
+		return p.Action
+	}
+	return p.Action + " on " + p.Resource
+}
+
+// PermissionChecker reports which of perms the target's role is not allowed.
+type PermissionChecker interface {
+	MissingPermissions(ctx context.Context, target jobs.AWSTarget, perms []Permission) ([]Permission, error)
+}
+
+// errPermissionCheckUnavailable means the role could be assumed but isn't
+// allowed to run the check, so nothing is known about its permissions.
+var errPermissionCheckUnavailable = errors.New("permission check unavailable")
+
+// IAMPermissionChecker asks IAM's policy simulator, using the role's own
+// credentials. The role needs iam:SimulatePrincipalPolicy on itself; without
+// it the check is unavailable (errPermissionCheckUnavailable).
+type IAMPermissionChecker struct{}
+
+func (IAMPermissionChecker) MissingPermissions(ctx context.Context, target jobs.AWSTarget, perms []Permission) ([]Permission, error) {
+	switch target.CredentialProvider {
+	case awsutil.ProviderStatic:
+		// No role to simulate; the worker's keys are the developer's own.
+		return nil, nil
+	case awsutil.ProviderWebIdentity:
+		// Only the worker holds the token the role trusts.
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	awsCfg, err := roleConfig(ctx, target, "aip-preflight")
+	if err != nil {
+		return nil, err
+	}
+	// Assume the role up front, so an AccessDenied below is the simulation's.
+	if _, err := awsCfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("assume %s: %w", target.RoleArn, err)
+	}
+	client := iam.NewFromConfig(awsCfg)
+
+	// One simulation per resource; actions without one are evaluated on "*".
+	byResource := map[string][]string{}
+	for _, p := range perms {
+		byResource[p.Resource] = append(byResource[p.Resource], p.Action)
+	}
+
+	var missing []Permission
+	for resource, actions := range byResource {
+		in := &iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(target.RoleArn),
+			ActionNames:     actions,
+		}
+		if resource != "" {
+			in.ResourceArns = []string{resource}
+		}
+
+		pages := iam.NewSimulatePrincipalPolicyPaginator(client, in)
+		for pages.HasMorePages() {
+			page, err := pages.NextPage(ctx)
+			var apiErr smithy.APIError
+			if errors.As(err, &apiErr) && apiErr.ErrorCode() == "AccessDenied" {
+				return nil, fmt.Errorf("%w: %s may not call iam:SimulatePrincipalPolicy: %w", errPermissionCheckUnavailable, target.RoleArn, err)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("simulate policy for %s: %w", target.RoleArn, err)
+			}
+			for _, r := range page.EvaluationResults {
+				if r.EvalDecision != iamtypes.PolicyEvaluationDecisionTypeAllowed {
+					missing = append(missing, Permission{Action: aws.ToString(r.EvalActionName), Resource: resource})
+				}
+			}
+		}
+	}
+	return missing, nil
+}
+
+// StaticPermissionChecker is a local stand-in for IAM: a role is allowed
+// exactly the actions matching Allowed (path.Match patterns such as "ecs:*"),
+// on any resource.
+type StaticPermissionChecker struct {
+	Allowed []string
+}
+
+func (s StaticPermissionChecker) MissingPermissions(_ context.Context, _ jobs.AWSTarget, perms []Permission) ([]Permission, error) {
+	var missing []Permission
+	for _, p := range perms {
+		if !s.allows(p.Action) {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+func (s StaticPermissionChecker) allows(action string) bool {
+	action = strings.ToLower(action)
+	for _, pattern := range s.Allowed {
+		if ok, _ := path.Match(strings.ToLower(pattern), action); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// blueprintPermissions returns the permissions a blueprint declares for
+// action (drift uses plan's). Blueprints without a schema or a permissions
+// section declare none.
+func (d *ServerDeps) blueprintPermissions(key, version, action string) ([]Permission, error) {
+	schema, err := d.loadBlueprintSchema(key, version)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+	if action == jobs.ActionDrift {
+		// A drift run is a refresh + plan.
+		action = jobs.ActionPlan
+	}
+	return schema.Permissions[action], nil
+}
+
+// expandResource fills ${accountId}, ${region} and ${<input>} in a declared
+// resource ARN. Unknown or non-scalar references become "*".
+func expandResource(resource string, conn *awsConnection, inputs map[string]any) string {
+	return os.Expand(resource, func(name string) string {
+		switch name {
+		case "accountId":
+			return conn.AccountID
+		case "region":
+			return conn.Region
+		}
+		switch v := inputs[name].(type) {
+		case string:
+			return v
+		case float64, int, int64, bool:
+			return fmt.Sprint(v)
+		}
+		return "*"
+	})
+}
+
+// missingPermissions returns the declared permissions conn's role lacks for
+// running action on the blueprint, formatted for the user and sorted.
+func (d *ServerDeps) missingPermissions(ctx context.Context, conn *awsConnection, key, version, action string, inputs map[string]any) ([]string, error) {
+	if d.Permissions == nil {
+		return nil, nil
+	}
+
+	perms, err := d.blueprintPermissions(key, version, action)
+	if err != nil || len(perms) == 0 {
+		return nil, err
+	}
+	for i := range perms {
+		if perms[i].Resource != "" {
+			perms[i].Resource = expandResource(perms[i].Resource, conn, inputs)
+		}
+	}
+
+	missing, err := d.Permissions.MissingPermissions(ctx, conn.jobAWS(), perms)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]string, len(missing))
+	for i, p := range missing {
+		out[i] = p.String()
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// preflight checks conn's role against the blueprint's declared permissions
+// before a run is created. It reports whether the run may go ahead; if not,
+// it has already written the response. A role that can't run the check is
+// let through with a warning; the run itself will find any gaps.
+func (d *ServerDeps) preflight(c *gin.Context, conn *awsConnection, key, version, action string, inputs map[string]any) bool {
+	missing, err := d.missingPermissions(c.Request.Context(), conn, key, version, action, inputs)
+	if errors.Is(err, errPermissionCheckUnavailable) {
+		slog.WarnContext(c.Request.Context(), "pre-flight permission check skipped",
+			"connection_id", conn.ID, logging.Err(err))
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "pre-flight permission check failed: " + err.Error()})
+		return false
+	}
+	if len(missing) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":          fmt.Sprintf("connection role is missing IAM permissions %s@%s needs for %s", key, version, action),
+			"connectionId":   conn.ID,
+			"missingActions": missing,
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testSchema = `
+permissions:
+  plan:
+    - logs:DescribeLogGroups
+    - ecs:DescribeServices
+    - action: iam:GetRole
+      resource: arn:aws:iam::${accountId}:role/${serviceName}-execution
+    - action: logs:CreateLogStream
+      resource: arn:aws:logs:${region}:${accountId}:log-group:/ecs/${serviceName}-${desiredCount}
+    - action: s3:GetObject
+      resource: arn:aws:s3:::${bucket}/*
+  apply:
+    - ecs:CreateService
+    - ec2:CreateSecurityGroup
+`
+
+func testDeps(t *testing.T, allowed ...string) *ServerDeps {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "ecs-service", "1.0.0")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "schema.yaml"), []byte(testSchema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return &ServerDeps{
+		BlueprintsRoot: root,
+		Permissions:    StaticPermissionChecker{Allowed: allowed},
+	}
+}
+
+func TestMissingPermissions(t *testing.T) {
+	conn := &awsConnection{AccountID: "123456789012", Region: "ap-northeast-1", RoleArn: "arn:aws:iam::123456789012:role/aip"}
+	inputs := map[string]any{
+		"serviceName":  "web",
+		"desiredCount": float64(2), // as decoded from JSON
+		"bucket":       []any{"not", "a", "scalar"},
+	}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		key     string
+		action  string
+		want    []string
+	}{
+		{
+			name:   "expands ${accountId}, ${region} and inputs; unknown ones become *",
+			key:    "ecs-service",
+			action: "plan",
+			want: []string{
+				"ecs:DescribeServices",
+				"iam:GetRole on arn:aws:iam::123456789012:role/web-execution",
+				"logs:CreateLogStream on arn:aws:logs:ap-northeast-1:123456789012:log-group:/ecs/web-2",
+				"logs:DescribeLogGroups",
+				"s3:GetObject on arn:aws:s3:::*/*",
+			},
+		},
+		{
+			name:    "drift checks plan's permissions",
+			allowed: []string{"logs:*", "iam:*", "s3:*"},
+			key:     "ecs-service",
+			action:  "drift",
+			want:    []string{"ecs:DescribeServices"},
+		},
+		{
+			name:   "sorted, not in declared order",
+			key:    "ecs-service",
+			action: "apply",
+			want:   []string{"ec2:CreateSecurityGroup", "ecs:CreateService"},
+		},
+		{
+			name:    "patterns match case-insensitively",
+			allowed: []string{"ECS:*", "ec2:create*"},
+			key:     "ecs-service",
+			action:  "apply",
+			want:    []string{},
+		},
+		{
+			name:   "blueprint without a schema declares nothing",
+			key:    "laravel-app",
+			action: "apply",
+			want:   nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDeps(t, tt.allowed...)
+			got, err := d.missingPermissions(context.Background(), conn, tt.key, "1.0.0", tt.action, inputs)
+			if err != nil {
+				t.Fatalf("missingPermissions: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("missing = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingPermissionsWithoutChecker(t *testing.T) {
+	d := testDeps(t)
+	d.Permissions = nil
+	got, err := d.missingPermissions(context.Background(), &awsConnection{}, "ecs-service", "1.0.0", "apply", nil)
+	if err != nil || got != nil {
+		t.Fatalf("missingPermissions = %q, %v; want nil, nil", got, err)
+	}
+}
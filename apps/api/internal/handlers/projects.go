@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProjectReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type ProjectResp struct {
+	ID           int64             `json:"id"`
+	OrgID        int64             `json:"orgId"`
+	Name         string            `json:"name"`
+	Environments []EnvironmentResp `json:"environments,omitempty"`
+}
+
+// POST /v1/projects
+func (d *ServerDeps) CreateProject(c *gin.Context) {
+	var req ProjectReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be empty"})
+		return
+	}
+
+	orgID := callerOrgID(c)
+
+	res, err := d.DB.ExecContext(c.Request.Context(),
+		`INSERT INTO projects (org_id, name) VALUES (?, ?)`,
+		orgID, name,
+	)
+	if isDuplicateKey(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a project with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert project: " + err.Error()})
+		return
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get project id"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ProjectResp{ID: id, OrgID: orgID, Name: name})
+}
+
+// projectSorts are the ?sort= keys accepted by ListProjects.
+var projectSorts = map[string]sortField{
+	"name": {Column: "name"},
+	"id":   {Column: "id"},
+}
+
+// GET /v1/projects
+func (d *ServerDeps) ListProjects(c *gin.Context) {
+	lp, err := parseListParams(c, projectSorts, "name")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := []string{"org_id = ?"}
+	args := []any{callerOrgID(c)}
+
+	clause, cargs, err := lp.keyset("id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
+	rows, err := d.DB.QueryContext(c.Request.Context(), `
+		SELECT id, org_id, name
+		FROM projects
+		WHERE `+strings.Join(where, " AND ")+`
+		`+lp.orderBy("id"), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query projects"})
+		return
+	}
+	defer rows.Close()
+
+	list := []ProjectResp{}
+	for rows.Next() {
+		var p ProjectResp
+		if err := rows.Scan(&p.ID, &p.OrgID, &p.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to scan project"})
+			return
+		}
+		list = append(list, p)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "rows error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPage(c, lp, list, func(p ProjectResp) (any, int64) {
+		if lp.Name == "id" {
+			return p.ID, p.ID
+		}
+		return p.Name, p.ID
+	}))
+}
+
+// GET /v1/projects/:id
+func (d *ServerDeps) GetProject(c *gin.Context) {
+	projectID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid project id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	var p ProjectResp
+	err := d.DB.QueryRowContext(ctx,
+		`SELECT id, org_id, name FROM projects WHERE id = ? AND org_id = ?`,
+		projectID, callerOrgID(c),
+	).Scan(&p.ID, &p.OrgID, &p.Name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load project"})
+		return
+	}
+
+	envs, err := d.queryEnvironments(c, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query environments"})
+		return
+	}
+	p.Environments = envs
+
+	c.JSON(http.StatusOK, p)
+}
+
+// PATCH /v1/projects/:id
+func (d *ServerDeps) UpdateProject(c *gin.Context) {
+	projectID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid project id"})
+		return
+	}
+
+	var req ProjectReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name must not be empty"})
+		return
+	}
+
+	orgID := callerOrgID(c)
+
+	res, err := d.DB.ExecContext(c.Request.Context(),
+		`UPDATE projects SET name = ? WHERE id = ? AND org_id = ?`,
+		name, projectID, orgID,
+	)
+	if isDuplicateKey(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a project with this name already exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update project: " + err.Error()})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// MySQL reports 0 rows when the name is unchanged, so double-check existence.
+		exists, err := d.projectExists(c, projectID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load project"})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, ProjectResp{ID: projectID, OrgID: orgID, Name: name})
+}
+
+// DELETE /v1/projects/:id
+// Refuses while the project still has environments.
+func (d *ServerDeps) DeleteProject(c *gin.Context) {
+	projectID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid project id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	exists, err := d.projectExists(c, projectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load project"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "project not found"})
+		return
+	}
+
+	var envCount int
+	if err := d.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM environments WHERE project_id = ?`,
+		projectID,
+	).Scan(&envCount); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to count environments"})
+		return
+	}
+	if envCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "project still has environments; delete them first"})
+		return
+	}
+
+	if _, err := d.DB.ExecContext(ctx,
+		`DELETE FROM projects WHERE id = ? AND org_id = ?`,
+		projectID, callerOrgID(c),
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete project: " + err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// projectExists reports whether the project exists in the caller's org.
+func (d *ServerDeps) projectExists(c *gin.Context, projectID int64) (bool, error) {
+	var id int64
+	err := d.DB.QueryRowContext(c.Request.Context(),
+		`SELECT id FROM projects WHERE id = ? AND org_id = ?`,
+		projectID, callerOrgID(c),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+const redactedValue = "***REDACTED***"
+
+// sensitiveKeyRE matches input names whose values must never be echoed back
+// (e.g. the blueprint "secrets" map or "db_password").
+var sensitiveKeyRE = regexp.MustCompile(`(?i)(secret|password|passwd|token|private_?key|api_?key|credential)`)
+
+// redactInputs returns a copy of v with the values of sensitive keys
+// replaced, recursing into nested objects and arrays.
+func redactInputs(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, val := range t {
+			if sensitiveKeyRE.MatchString(k) && val != nil {
+				out[k] = redactedValue
+				continue
+			}
+			out[k] = redactInputs(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, val := range t {
+			out[i] = redactInputs(val)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// redactOutputs masks the value of every output terraform flagged as
+// sensitive in `terraform output -json`. Unparseable input is returned as-is.
+func redactOutputs(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+	var outputs map[string]map[string]any
+	if err := json.Unmarshal(raw, &outputs); err != nil {
+		return raw
+	}
+	for _, o := range outputs {
+		if sensitive, _ := o["sensitive"].(bool); sensitive {
+			o["value"] = redactedValue
+		}
+	}
+	b, err := json.Marshal(outputs)
+	if err != nil {
+		return raw
+	}
+	return b
+}
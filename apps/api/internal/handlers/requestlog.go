@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// RequestIDHeader carries the request's ID. A well-formed ID sent by the
+// client (or a proxy in front of us) is kept; otherwise one is generated.
+// Either way it is returned on the response, so support can find the logs
+// for a call.
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDRE = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// idRoutes are the route prefixes whose :id is a deployment or a run, and
+// the attribute it is logged under.
+var idRoutes = []struct {
+	prefix string
+	key    string
+}{
+	{"/v1/deployments/:id", logging.KeyDeploymentID},
+	{"/v1/runs/:id", logging.KeyRunID},
+}
+
+// RequestLogger assigns each request an ID, makes it (and the deployment or
+// run the route names) part of the request context's log attributes, and
+// logs the request once handled. Health checks and scrapes are logged at
+// debug level.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDRE.MatchString(id) {
+			id = rand.Text()
+		}
+		c.Header(RequestIDHeader, id)
+
+		attrs := []slog.Attr{slog.String(logging.KeyRequestID, id)}
+		route := c.FullPath()
+		for _, r := range idRoutes {
+			if route == r.prefix || strings.HasPrefix(route, r.prefix+"/") {
+				if n, ok := idParam(c, "id"); ok {
+					attrs = append(attrs, slog.Int64(r.key, n))
+				}
+			}
+		}
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(), attrs...))
+
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case route == "/healthz" || route == "/metrics":
+			level = slog.LevelDebug
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		if route == "" {
+			route = "unmatched"
+		}
+		// Later middleware (CallerLogger) may have added to the context
+		slog.LogAttrs(c.Request.Context(), level, "request",
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Int("bytes", max(c.Writer.Size(), 0)),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+		)
+	}
+}
+
+// CallerLogger adds the authenticated caller to the request context's log
+// attributes. It must run after Caller.
+func CallerLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(logging.With(c.Request.Context(),
+			slog.String(logging.KeyUser, c.GetString("user_email")),
+			slog.Int64(logging.KeyUserID, callerUserID(c)),
+			slog.Int64(logging.KeyOrgID, callerOrgID(c)),
+		))
+		c.Next()
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Resource is an AWS resource in a deployment's terraform state, as synced by
+// the worker after each apply and destroy.
+type Resource struct {
+	ID           int64             `json:"id"`
+	DeploymentID int64             `json:"deploymentId"`
+	ARN          string            `json:"arn"`
+	Address      string            `json:"address"` // terraform resource address
+	Type         string            `json:"type"`    // terraform resource type, e.g. aws_ecs_service
+	Name         *string           `json:"name,omitempty"`
+	Region       *string           `json:"region,omitempty"` // empty for global resources (IAM)
+	Tags         map[string]string `json:"tags"`
+	LastRunID    *int64            `json:"lastRunId,omitempty"` // run whose state it was last seen in
+	UpdatedAt    time.Time         `json:"updatedAt"`
+}
+
+// resourceSorts are the ?sort= keys accepted by ListDeploymentResources.
+var resourceSorts = map[string]sortField{
+	"id":   {Column: "res.id"},
+	"type": {Column: "res.type"},
+}
+
+// GET /v1/deployments/:id/resources
+// Lists the AWS resources in a deployment's state. Supports cursor pagination
+// (?limit=, ?cursor=), ?sort= and ?type=.
+func (d *ServerDeps) ListDeploymentResources(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	lp, err := parseListParams(c, resourceSorts, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+
+	where := []string{"res.deployment_id = ?"}
+	args := []any{deploymentID}
+
+	if v := c.Query("type"); v != "" {
+		where = append(where, "res.type = ?")
+		args = append(args, v)
+	}
+
+	clause, cargs, err := lp.keyset("res.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
+	resources, err := queryResources(ctx, d.DB, strings.Join(where, " AND "), args, lp.orderBy("res.id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query resources"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPage(c, lp, resources, func(r Resource) (any, int64) {
+		if lp.Name == "type" {
+			return r.Type, r.ID
+		}
+		return r.ID, r.ID
+	}))
+}
+
+// GET /v1/resources?arn=
+// Finds the deployment(s) in the caller's org whose state holds the resource
+// with the given ARN.
+func (d *ServerDeps) LookupResource(c *gin.Context) {
+	arn := strings.TrimSpace(c.Query("arn"))
+	if !strings.HasPrefix(arn, "arn:") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "arn query parameter is required"})
+		return
+	}
+
+	resources, err := queryResources(c.Request.Context(), d.DB, `
+		res.arn = ? AND res.deployment_id IN (
+			SELECT dep.id
+			FROM deployments dep
+			JOIN environments e ON e.id = dep.environment_id
+			JOIN projects p ON p.id = e.project_id
+			WHERE p.org_id = ?
+		)`, []any{arn, callerOrgID(c)}, "ORDER BY res.id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query resources"})
+		return
+	}
+	if len(resources) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no deployment manages this resource"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Page[Resource]{Items: resources})
+}
+
+// queryResources loads resources (aliased res) matching where (with args), in
+// the given ORDER BY/LIMIT tail.
+func queryResources(ctx context.Context, db *sql.DB, where string, args []any, tail string) ([]Resource, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT res.id, res.deployment_id, res.arn, res.address, res.type, res.name, res.region,
+		       res.tags_json, res.last_run_id, res.updated_at
+		FROM resources res
+		WHERE `+where+`
+		`+tail, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Resource
+	for rows.Next() {
+		var (
+			r       Resource
+			name    sql.NullString
+			region  sql.NullString
+			tagsRaw sql.NullString
+			lastRun sql.NullInt64
+		)
+		if err := rows.Scan(&r.ID, &r.DeploymentID, &r.ARN, &r.Address, &r.Type, &name, &region,
+			&tagsRaw, &lastRun, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if name.Valid {
+			r.Name = &name.String
+		}
+		if region.Valid {
+			r.Region = &region.String
+		}
+		r.Tags = map[string]string{}
+		if tagsRaw.Valid {
+			if err := json.Unmarshal([]byte(tagsRaw.String), &r.Tags); err != nil {
+				return nil, err
+			}
+		}
+		if lastRun.Valid {
+			r.LastRunID = &lastRun.Int64
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Where a deployment revision came from.
+const (
+	RevisionSourceCreate   = "create"
+	RevisionSourceUpdate   = "update"
+	RevisionSourceRollback = "rollback"
+)
+
+// currentRevisionSQL selects the id of a deployment's latest revision; it
+// takes the deployment id as its argument.
+const currentRevisionSQL = `(SELECT MAX(rev.id) FROM deployment_revisions rev WHERE rev.deployment_id = ?)`
+
+// revisionChange is a blueprint version and inputs to make a deployment's
+// next revision before running it.
+type revisionChange struct {
+	BlueprintID int64
+	InputsJSON  string
+	Source      string // RevisionSourceUpdate or RevisionSourceRollback
+
+	// Revision row the change was made from, if it must still be current
+	// (errRevisionConflict otherwise)
+	BaseRevisionID int64
+
+	// Rollbacks: the earlier apply whose revision is restored
+	RollbackOfRunID *int64
+}
+
+// insertRevision records blueprintID and inputsJSON as the deployment's next
+// revision. It returns the row id and the revision number.
+func insertRevision(ctx context.Context, tx *sql.Tx, deploymentID, blueprintID int64, inputsJSON, source string, createdBy *int64) (int64, int, error) {
+	var next int
+	if err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(revision), 0) + 1 FROM deployment_revisions WHERE deployment_id = ?`, deploymentID,
+	).Scan(&next); err != nil {
+		return 0, 0, err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO deployment_revisions (deployment_id, revision, blueprint_id, inputs_json, source, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, deploymentID, next, blueprintID, inputsJSON, source, createdBy)
+	if err != nil {
+		return 0, 0, err
+	}
+	id, err := res.LastInsertId()
+	return id, next, err
+}
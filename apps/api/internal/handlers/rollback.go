@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+type RollbackDeploymentReq struct {
+	// Successful apply of this deployment whose blueprint version and inputs
+	// to restore. Defaults to the latest successful apply of an earlier
+	// revision than the current one.
+	RunID  *int64 `json:"runId"`
+	Action string `json:"action"` // "plan" or "apply" (optional, defaults to "apply")
+}
+
+// POST /v1/deployments/:id/rollback
+// Restores the blueprint version and inputs a previous apply ran with as the
+// deployment's next revision, and queues a run of it linked to that apply.
+func (d *ServerDeps) RollbackDeployment(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	// The body is optional
+	var req RollbackDeploymentReq
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	if action == "" {
+		action = jobs.ActionApply
+	}
+	if action != jobs.ActionPlan && action != jobs.ActionApply {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action; must be 'plan' or 'apply'"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+
+	// Resolve the apply to roll back to and the revision it ran
+	var (
+		targetRunID int64
+		change      = revisionChange{Source: RevisionSourceRollback}
+		revision    int
+		key         string
+		version     string
+	)
+	const targetColumns = `
+		SELECT r.id, rev.revision, rev.blueprint_id, rev.inputs_json, b.blueprint_key, b.version
+		FROM runs r
+		JOIN deployment_revisions rev ON rev.id = r.revision_id
+		JOIN blueprints b ON b.id = rev.blueprint_id
+		WHERE r.deployment_id = ? AND r.action = 'apply' AND r.status = 'succeeded'`
+	var row *sql.Row
+	if req.RunID != nil {
+		row = d.DB.QueryRowContext(ctx, targetColumns+` AND r.id = ?`, deploymentID, *req.RunID)
+	} else {
+		row = d.DB.QueryRowContext(ctx, targetColumns+`
+			  AND r.revision_id <> `+currentRevisionSQL+`
+			ORDER BY r.id DESC
+			LIMIT 1
+		`, deploymentID, deploymentID)
+	}
+	err = row.Scan(&targetRunID, &revision, &change.BlueprintID, &change.InputsJSON, &key, &version)
+	if err == sql.ErrNoRows {
+		if req.RunID != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "runId is not a successful apply of this deployment"})
+		} else {
+			c.JSON(http.StatusConflict, gin.H{"error": "no earlier successful apply to roll back to"})
+		}
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve rollback target: " + err.Error()})
+		return
+	}
+	change.RollbackOfRunID = &targetRunID
+
+	var inputs map[string]any
+	if err := json.Unmarshal([]byte(change.InputsJSON), &inputs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decode revision inputs"})
+		return
+	}
+
+	conn, err := loadDeploymentConnection(ctx, d.DB, deploymentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is not bound to an AWS connection"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve connection: " + err.Error()})
+		return
+	}
+	if !conn.usable() {
+		c.JSON(http.StatusConflict, gin.H{"error": "connection is " + conn.Status + "; re-verify it (POST /v1/connections/aws/:id/verify) before rolling back"})
+		return
+	}
+	if !d.preflight(c, conn, key, version, action, inputs) {
+		return
+	}
+
+	userID := callerUserID(c)
+	runID, newRevision, err := d.startRevisedRun(ctx, deploymentID, &change, action, &userID)
+	if errors.Is(err, errRunInProgress) || errors.Is(err, errConnectionUnusable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start rollback: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"deploymentId":     deploymentID,
+		"runId":            runID,
+		"status":           "queued",
+		"revision":         newRevision,
+		"rollbackOfRunId":  targetRunID,
+		"restoredRevision": revision,
+		"blueprintKey":     key,
+		"version":          version,
+	})
+}
@@ -1,14 +1,55 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// RunSummary is one entry of a deployment's run history.
+type RunSummary struct {
+	ID              int64      `json:"id"`
+	DeploymentID    int64      `json:"deploymentId"`
+	Action          string     `json:"action"`
+	Status          string     `json:"status"`
+	Summary         *string    `json:"summary,omitempty"` // plan/apply summary, or the failure reason
+	TriggeredBy     *UserRef   `json:"triggeredBy,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+	DurationSeconds *float64   `json:"durationSeconds,omitempty"`
+
+	// Deployment revision the run deployed, and for rollbacks the earlier
+	// apply it restored
+	Revision        *int   `json:"revision,omitempty"`
+	RollbackOfRunID *int64 `json:"rollbackOfRunId,omitempty"`
+
+	// Gated applies: approvals needed, and when a run awaiting them expires
+	RequiredApprovals *int64     `json:"requiredApprovals,omitempty"`
+	ApprovalExpiresAt *time.Time `json:"approvalExpiresAt,omitempty"`
+}
+
+// RunAttempt is one try the worker made at a run; transient failures are
+// retried.
+type RunAttempt struct {
+	Attempt         int        `json:"attempt"`
+	Step            string     `json:"step,omitempty"` // gated applies: plan_for_approval or apply_plan
+	StartedAt       time.Time  `json:"startedAt"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+	DurationSeconds *float64   `json:"durationSeconds,omitempty"`
+	Error           *string    `json:"error,omitempty"`
+	Retryable       bool       `json:"retryable"` // whether the error was classed as transient
+}
+
 // GET /v1/runs/:id
+// Includes the worker's attempts at the run, the outputs it produced (applies
+// and destroys) and, for gated applies, the approvals recorded so far.
 func (d *ServerDeps) GetRun(c *gin.Context) {
 	idStr := c.Param("id")
 	runID, err := strconv.ParseInt(idStr, 10, 64)
@@ -24,15 +65,23 @@ func (d *ServerDeps) GetRun(c *gin.Context) {
 		summary      sql.NullString
 		startedAt    sql.NullTime
 		finishedAt   sql.NullTime
+		required     sql.NullInt64
+		approvalExp  sql.NullTime
+		revision     sql.NullInt64
+		rollbackOf   sql.NullInt64
+		outputsRaw   sql.NullString
 	)
 
 	err = d.DB.QueryRowContext(
 		c.Request.Context(),
-		`SELECT deployment_id, action, status, summary, started_at, finished_at
-         FROM runs
-         WHERE id = ?`,
+		`SELECT r.deployment_id, r.action, r.status, r.summary, r.started_at, r.finished_at,
+                r.required_approvals, r.approval_expires_at, rev.revision, r.rollback_of_run_id,
+                r.outputs_json
+         FROM runs r
+         LEFT JOIN deployment_revisions rev ON rev.id = r.revision_id
+         WHERE r.id = ?`,
 		runID,
-	).Scan(&deploymentID, &action, &status, &summary, &startedAt, &finishedAt)
+	).Scan(&deploymentID, &action, &status, &summary, &startedAt, &finishedAt, &required, &approvalExp, &revision, &rollbackOf, &outputsRaw)
 
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
@@ -59,6 +108,241 @@ func (d *ServerDeps) GetRun(c *gin.Context) {
 	if finishedAt.Valid {
 		resp["finishedAt"] = finishedAt.Time
 	}
+	if revision.Valid {
+		resp["revision"] = revision.Int64
+	}
+	if rollbackOf.Valid {
+		resp["rollbackOfRunId"] = rollbackOf.Int64
+	}
+	if outputsRaw.Valid {
+		resp["outputs"] = redactOutputs(json.RawMessage(outputsRaw.String))
+	}
+
+	attempts, err := d.loadRunAttempts(c.Request.Context(), runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load attempts"})
+		return
+	}
+	resp["attempts"] = attempts
+
+	if required.Int64 > 0 {
+		approvals, err := d.loadRunApprovals(c.Request.Context(), runID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load approvals"})
+			return
+		}
+		resp["requiredApprovals"] = required.Int64
+		resp["approvals"] = approvals
+		if approvalExp.Valid {
+			resp["approvalExpiresAt"] = approvalExp.Time
+		}
+	}
 
 	c.JSON(http.StatusOK, resp)
 }
+
+// runSorts are the ?sort= keys accepted by ListDeploymentRuns.
+var runSorts = map[string]sortField{
+	"id": {Column: "r.id"},
+}
+
+// GET /v1/deployments/:id/runs
+// Paged run history, newest first. Filters: action, status.
+func (d *ServerDeps) ListDeploymentRuns(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	lp, err := parseListParams(c, runSorts, "-id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+
+	where := []string{"r.deployment_id = ?"}
+	args := []any{deploymentID}
+
+	if v := c.Query("action"); v != "" {
+		where = append(where, "r.action = ?")
+		args = append(args, v)
+	}
+	if v := c.Query("status"); v != "" {
+		where = append(where, "r.status = ?")
+		args = append(args, v)
+	}
+
+	clause, cargs, err := lp.keyset("r.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
+	runs, err := d.queryRuns(ctx, strings.Join(where, " AND "), args, lp.orderBy("r.id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query runs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPage(c, lp, runs, func(r RunSummary) (any, int64) {
+		return r.ID, r.ID
+	}))
+}
+
+// queryRuns loads run summaries matching where (with args), in the given
+// ORDER BY/LIMIT tail.
+func (d *ServerDeps) queryRuns(ctx context.Context, where string, args []any, tail string) ([]RunSummary, error) {
+	rows, err := d.DB.QueryContext(ctx, `
+        SELECT
+            r.id,
+            r.deployment_id,
+            r.action,
+            r.status,
+            r.summary,
+            r.created_at,
+            r.started_at,
+            r.finished_at,
+            r.required_approvals,
+            r.approval_expires_at,
+            rev.revision,
+            r.rollback_of_run_id,
+            u.id,
+            u.email
+        FROM runs r
+        LEFT JOIN deployment_revisions rev ON rev.id = r.revision_id
+        LEFT JOIN users u ON r.triggered_by = u.id
+        WHERE `+where+`
+        `+tail, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []RunSummary
+	for rows.Next() {
+		var (
+			r          RunSummary
+			summary    sql.NullString
+			startedAt  sql.NullTime
+			finishedAt sql.NullTime
+			required   sql.NullInt64
+			approvalAt sql.NullTime
+			revision   sql.NullInt64
+			rollbackOf sql.NullInt64
+			userID     sql.NullInt64
+			userEmail  sql.NullString
+		)
+		if err := rows.Scan(
+			&r.ID,
+			&r.DeploymentID,
+			&r.Action,
+			&r.Status,
+			&summary,
+			&r.CreatedAt,
+			&startedAt,
+			&finishedAt,
+			&required,
+			&approvalAt,
+			&revision,
+			&rollbackOf,
+			&userID,
+			&userEmail,
+		); err != nil {
+			return nil, err
+		}
+
+		if summary.Valid {
+			s := summary.String
+			r.Summary = &s
+		}
+		if startedAt.Valid {
+			t := startedAt.Time
+			r.StartedAt = &t
+		}
+		if finishedAt.Valid {
+			t := finishedAt.Time
+			r.FinishedAt = &t
+		}
+		if startedAt.Valid && finishedAt.Valid {
+			secs := finishedAt.Time.Sub(startedAt.Time).Seconds()
+			r.DurationSeconds = &secs
+		}
+		if required.Int64 > 0 {
+			n := required.Int64
+			r.RequiredApprovals = &n
+		}
+		if approvalAt.Valid {
+			t := approvalAt.Time
+			r.ApprovalExpiresAt = &t
+		}
+		if revision.Valid {
+			n := int(revision.Int64)
+			r.Revision = &n
+		}
+		if rollbackOf.Valid {
+			id := rollbackOf.Int64
+			r.RollbackOfRunID = &id
+		}
+		if userID.Valid {
+			r.TriggeredBy = &UserRef{ID: userID.Int64, Email: userEmail.String}
+		}
+
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// loadRunAttempts returns the worker's attempts at a run in the order made.
+func (d *ServerDeps) loadRunAttempts(ctx context.Context, runID int64) ([]RunAttempt, error) {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT attempt, step, started_at, finished_at, error, retryable
+		FROM run_attempts
+		WHERE run_id = ?
+		ORDER BY id
+	`, runID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []RunAttempt{}
+	for rows.Next() {
+		var (
+			a          RunAttempt
+			finishedAt sql.NullTime
+			msg        sql.NullString
+		)
+		if err := rows.Scan(&a.Attempt, &a.Step, &a.StartedAt, &finishedAt, &msg, &a.Retryable); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			t := finishedAt.Time
+			a.FinishedAt = &t
+			secs := t.Sub(a.StartedAt).Seconds()
+			a.DurationSeconds = &secs
+		}
+		if msg.Valid {
+			s := msg.String
+			a.Error = &s
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
@@ -0,0 +1,658 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/robfig/cron/v3"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+const (
+	// DefaultSchedulerInterval is how often due schedules are fired.
+	DefaultSchedulerInterval = 30 * time.Second
+
+	// minScheduleSpacing is the shortest gap allowed between two firings.
+	minScheduleSpacing = 5 * time.Minute
+
+	scheduleBatchSize = 50
+)
+
+// Outcomes recorded in schedule_firings.status.
+const (
+	FiringStarted = "started" // a run was enqueued
+	FiringSkipped = "skipped" // the deployment couldn't take a run right now
+	FiringFailed  = "failed"  // the run could not be created or enqueued
+)
+
+// cronParser accepts standard 5-field expressions and descriptors such as
+// @daily or @every 6h. Time zones come from the schedule, not CRON_TZ=.
+var cronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+type CreateScheduleReq struct {
+	Action   string `json:"action" binding:"required"` // plan, apply, destroy or drift
+	Cron     string `json:"cron" binding:"required"`
+	Timezone string `json:"timezone"` // IANA name, defaults to UTC
+}
+
+type ScheduleResp struct {
+	ID           int64      `json:"id"`
+	DeploymentID int64      `json:"deploymentId"`
+	Action       string     `json:"action"`
+	Cron         string     `json:"cron"`
+	Timezone     string     `json:"timezone"`
+	Paused       bool       `json:"paused"`
+	NextRunAt    *time.Time `json:"nextRunAt,omitempty"` // unset while paused
+	LastFiredAt  *time.Time `json:"lastFiredAt,omitempty"`
+	CreatedBy    int64      `json:"createdBy"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+type ScheduleFiringResp struct {
+	ID           int64     `json:"id"`
+	ScheduledFor time.Time `json:"scheduledFor"`
+	FiredAt      time.Time `json:"firedAt"`
+	Status       string    `json:"status"`
+	RunID        *int64    `json:"runId,omitempty"`
+	Message      *string   `json:"message,omitempty"`
+}
+
+// parseSchedule validates a cron expression and time zone.
+func parseSchedule(expr, timezone string) (cron.Schedule, *time.Location, error) {
+	if strings.HasPrefix(expr, "CRON_TZ=") || strings.HasPrefix(expr, "TZ=") {
+		return nil, nil, errors.New("set the time zone with timezone, not in cron")
+	}
+	sched, err := cronParser.Parse(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cron: %w", err)
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone: %w", err)
+	}
+	return sched, loc, nil
+}
+
+// nextFiring is the first firing of expr in timezone strictly after t, in UTC.
+func nextFiring(expr, timezone string, t time.Time) (time.Time, error) {
+	sched, loc, err := parseSchedule(expr, timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return sched.Next(t.In(loc)).UTC(), nil
+}
+
+// scheduleInOrg reports whether a schedule's deployment belongs to orgID.
+func scheduleInOrg(ctx context.Context, q querier, scheduleID, orgID int64) (bool, error) {
+	var one int
+	err := q.QueryRowContext(ctx, `
+		SELECT 1
+		FROM schedules s
+		JOIN deployments dep ON dep.id = s.deployment_id
+		JOIN environments env ON env.id = dep.environment_id
+		JOIN projects p ON p.id = env.project_id
+		WHERE s.id = ? AND p.org_id = ?
+	`, scheduleID, orgID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// POST /v1/deployments/:id/schedules
+// Creates a schedule that starts an action on the deployment at each cron
+// firing. The deployment's connection is pre-flight checked for the action.
+func (d *ServerDeps) CreateSchedule(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	var req CreateScheduleReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	switch action {
+	case jobs.ActionPlan, jobs.ActionApply, jobs.ActionDestroy, jobs.ActionDrift:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid action; must be 'plan', 'apply', 'destroy' or 'drift'"})
+		return
+	}
+
+	expr := strings.TrimSpace(req.Cron)
+	timezone := req.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	sched, loc, err := parseSchedule(expr, timezone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	first := sched.Next(time.Now().In(loc))
+	if sched.Next(first).Sub(first) < minScheduleSpacing {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("schedule fires more often than every %s", minScheduleSpacing)})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+
+	job, conn, err := deploymentJob(ctx, d.DB, deploymentID, action)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment is not bound to an AWS connection"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve deployment: " + err.Error()})
+		return
+	}
+	if !d.preflight(c, conn, job.BlueprintKey, job.Version, action, job.Inputs) {
+		return
+	}
+
+	res, err := d.DB.ExecContext(ctx, `
+		INSERT INTO schedules (deployment_id, action, cron_expr, timezone, next_run_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, deploymentID, action, expr, timezone, first.UTC(), callerUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to insert schedule: " + err.Error()})
+		return
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get schedule id"})
+		return
+	}
+
+	s, err := d.loadSchedule(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load schedule"})
+		return
+	}
+	c.JSON(http.StatusCreated, s)
+}
+
+// scheduleSorts are the ?sort= keys accepted by ListSchedules.
+var scheduleSorts = map[string]sortField{
+	"id":        {Column: "s.id"},
+	"nextRunAt": {Column: "s.next_run_at", IsTime: true},
+}
+
+// GET /v1/schedules
+// Lists schedules in the caller's org. Supports cursor pagination, ?sort=
+// (id, nextRunAt) and the filters deploymentId, action and paused.
+func (d *ServerDeps) ListSchedules(c *gin.Context) {
+	lp, err := parseListParams(c, scheduleSorts, "-id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := []string{"p.org_id = ?"}
+	args := []any{callerOrgID(c)}
+
+	id, ok, err := queryID(c, "deploymentId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if ok {
+		where = append(where, "s.deployment_id = ?")
+		args = append(args, id)
+	}
+	if v := c.Query("action"); v != "" {
+		where = append(where, "s.action = ?")
+		args = append(args, v)
+	}
+	switch c.Query("paused") {
+	case "":
+	case "true":
+		where = append(where, "s.paused")
+	case "false":
+		where = append(where, "NOT s.paused")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "paused must be true or false"})
+		return
+	}
+	if lp.Name == "nextRunAt" {
+		// Paused schedules have no next run and can't take part in a keyset.
+		where = append(where, "s.next_run_at IS NOT NULL")
+	}
+
+	clause, cargs, err := lp.keyset("s.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
+	list, err := d.querySchedules(c.Request.Context(), strings.Join(where, " AND "), args, lp.orderBy("s.id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPage(c, lp, list, func(s ScheduleResp) (any, int64) {
+		if lp.Name == "nextRunAt" {
+			return *s.NextRunAt, s.ID
+		}
+		return s.ID, s.ID
+	}))
+}
+
+// GET /v1/schedules/:id
+func (d *ServerDeps) GetSchedule(c *gin.Context) {
+	s, ok := d.scheduleFromParam(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// POST /v1/schedules/:id/pause
+// Stops a schedule from firing until it is resumed.
+func (d *ServerDeps) PauseSchedule(c *gin.Context) {
+	s, ok := d.scheduleFromParam(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := d.DB.ExecContext(ctx,
+		`UPDATE schedules SET paused = TRUE, next_run_at = NULL WHERE id = ?`, s.ID,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to pause schedule: " + err.Error()})
+		return
+	}
+
+	d.respondSchedule(c, s.ID)
+}
+
+// POST /v1/schedules/:id/resume
+// Resumes a paused schedule from its next firing after now; firings missed
+// while paused are not made up.
+func (d *ServerDeps) ResumeSchedule(c *gin.Context) {
+	s, ok := d.scheduleFromParam(c)
+	if !ok {
+		return
+	}
+
+	next, err := nextFiring(s.Cron, s.Timezone, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "stored schedule is invalid: " + err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := d.DB.ExecContext(ctx,
+		`UPDATE schedules SET paused = FALSE, next_run_at = ? WHERE id = ? AND paused`, next, s.ID,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resume schedule: " + err.Error()})
+		return
+	}
+
+	d.respondSchedule(c, s.ID)
+}
+
+// DELETE /v1/schedules/:id
+// Deletes a schedule and its firing history; runs it started are kept.
+func (d *ServerDeps) DeleteSchedule(c *gin.Context) {
+	s, ok := d.scheduleFromParam(c)
+	if !ok {
+		return
+	}
+
+	if _, err := d.DB.ExecContext(c.Request.Context(),
+		`DELETE FROM schedules WHERE id = ?`, s.ID,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete schedule: " + err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// firingSorts are the ?sort= keys accepted by ListScheduleFirings.
+var firingSorts = map[string]sortField{
+	"id": {Column: "f.id"},
+}
+
+// GET /v1/schedules/:id/firings
+// Paged firing history, newest first. Filter: status.
+func (d *ServerDeps) ListScheduleFirings(c *gin.Context) {
+	s, ok := d.scheduleFromParam(c)
+	if !ok {
+		return
+	}
+
+	lp, err := parseListParams(c, firingSorts, "-id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	where := []string{"f.schedule_id = ?"}
+	args := []any{s.ID}
+	if v := c.Query("status"); v != "" {
+		where = append(where, "f.status = ?")
+		args = append(args, v)
+	}
+
+	clause, cargs, err := lp.keyset("f.id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if clause != "" {
+		where = append(where, clause)
+		args = append(args, cargs...)
+	}
+
+	rows, err := d.DB.QueryContext(c.Request.Context(), `
+		SELECT f.id, f.scheduled_for, f.fired_at, f.status, f.run_id, f.message
+		FROM schedule_firings f
+		WHERE `+strings.Join(where, " AND ")+`
+		`+lp.orderBy("f.id"), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query firings"})
+		return
+	}
+	defer rows.Close()
+
+	var list []ScheduleFiringResp
+	for rows.Next() {
+		var (
+			f       ScheduleFiringResp
+			runID   sql.NullInt64
+			message sql.NullString
+		)
+		if err := rows.Scan(&f.ID, &f.ScheduledFor, &f.FiredAt, &f.Status, &runID, &message); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to scan firings"})
+			return
+		}
+		if runID.Valid {
+			id := runID.Int64
+			f.RunID = &id
+		}
+		if message.Valid {
+			m := message.String
+			f.Message = &m
+		}
+		list = append(list, f)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "rows error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, buildPage(c, lp, list, func(f ScheduleFiringResp) (any, int64) {
+		return f.ID, f.ID
+	}))
+}
+
+// scheduleFromParam loads the :id schedule if it is in the caller's org,
+// writing the error response otherwise.
+func (d *ServerDeps) scheduleFromParam(c *gin.Context) (ScheduleResp, bool) {
+	scheduleID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule id"})
+		return ScheduleResp{}, false
+	}
+
+	ctx := c.Request.Context()
+
+	found, err := scheduleInOrg(ctx, d.DB, scheduleID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load schedule"})
+		return ScheduleResp{}, false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return ScheduleResp{}, false
+	}
+
+	s, err := d.loadSchedule(ctx, scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load schedule"})
+		return ScheduleResp{}, false
+	}
+	return s, true
+}
+
+func (d *ServerDeps) respondSchedule(c *gin.Context, scheduleID int64) {
+	s, err := d.loadSchedule(c.Request.Context(), scheduleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+func (d *ServerDeps) loadSchedule(ctx context.Context, scheduleID int64) (ScheduleResp, error) {
+	list, err := d.querySchedules(ctx, "s.id = ?", []any{scheduleID}, "")
+	if err != nil {
+		return ScheduleResp{}, err
+	}
+	if len(list) == 0 {
+		return ScheduleResp{}, sql.ErrNoRows
+	}
+	return list[0], nil
+}
+
+// querySchedules loads schedules matching where (with args), in the given
+// ORDER BY/LIMIT tail. The caller's org is joined in as p.
+func (d *ServerDeps) querySchedules(ctx context.Context, where string, args []any, tail string) ([]ScheduleResp, error) {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT s.id, s.deployment_id, s.action, s.cron_expr, s.timezone, s.paused,
+		       s.next_run_at, s.last_fired_at, s.created_by, s.created_at
+		FROM schedules s
+		JOIN deployments dep ON dep.id = s.deployment_id
+		JOIN environments env ON env.id = dep.environment_id
+		JOIN projects p ON p.id = env.project_id
+		WHERE `+where+`
+		`+tail, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []ScheduleResp
+	for rows.Next() {
+		var (
+			s         ScheduleResp
+			nextRunAt sql.NullTime
+			lastFired sql.NullTime
+		)
+		if err := rows.Scan(
+			&s.ID,
+			&s.DeploymentID,
+			&s.Action,
+			&s.Cron,
+			&s.Timezone,
+			&s.Paused,
+			&nextRunAt,
+			&lastFired,
+			&s.CreatedBy,
+			&s.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if nextRunAt.Valid {
+			t := nextRunAt.Time
+			s.NextRunAt = &t
+		}
+		if lastFired.Valid {
+			t := lastFired.Time
+			s.LastFiredAt = &t
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// RunScheduler fires due schedules every interval until ctx is cancelled.
+// Only the leader fires.
+func (d *ServerDeps) RunScheduler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		slog.InfoContext(ctx, "scheduler disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		d.fireDueSchedules(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *ServerDeps) fireDueSchedules(ctx context.Context) {
+	if !d.isLeader() {
+		return
+	}
+
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT id FROM schedules
+		WHERE NOT paused AND next_run_at <= NOW()
+		ORDER BY next_run_at
+		LIMIT ?
+	`, scheduleBatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "scheduler: query due schedules", logging.Err(err))
+		return
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			slog.ErrorContext(ctx, "scheduler: scan schedule", logging.Err(err))
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "scheduler: rows error", logging.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := d.fireSchedule(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "fire schedule", "schedule_id", id, logging.Err(err))
+		}
+	}
+}
+
+// fireSchedule claims a due firing by advancing next_run_at under a row lock,
+// then starts the run and records the outcome. Missed firings (e.g. while no
+// instance was leader) collapse into this one.
+func (d *ServerDeps) fireSchedule(ctx context.Context, scheduleID int64) error {
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		deploymentID int64
+		action       string
+		expr         string
+		timezone     string
+		scheduledFor time.Time
+	)
+	err = tx.QueryRowContext(ctx, `
+		SELECT deployment_id, action, cron_expr, timezone, next_run_at
+		FROM schedules
+		WHERE id = ? AND NOT paused AND next_run_at <= NOW()
+		FOR UPDATE
+	`, scheduleID).Scan(&deploymentID, &action, &expr, &timezone, &scheduledFor)
+	if err == sql.ErrNoRows {
+		return nil // paused, deleted or fired by someone else meanwhile
+	}
+	if err != nil {
+		return fmt.Errorf("lock schedule: %w", err)
+	}
+
+	next, err := nextFiring(expr, timezone, time.Now())
+	if err != nil {
+		// Can't happen for schedules created through the API; park it.
+		if _, err2 := tx.ExecContext(ctx,
+			`UPDATE schedules SET paused = TRUE, next_run_at = NULL WHERE id = ?`, scheduleID,
+		); err2 != nil {
+			return err2
+		}
+		if err2 := tx.Commit(); err2 != nil {
+			return err2
+		}
+		return fmt.Errorf("paused: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE schedules SET next_run_at = ?, last_fired_at = NOW() WHERE id = ?`, next, scheduleID,
+	); err != nil {
+		return fmt.Errorf("advance schedule: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	status, message := FiringStarted, ""
+	var runRef *int64
+	ctx = logging.WithDeployment(ctx, deploymentID)
+	runID, err := d.startDeploymentRun(ctx, deploymentID, action, nil)
+	switch {
+	case err == nil:
+		runRef = &runID
+	case errors.Is(err, errRunInProgress), errors.Is(err, errNotDeployed), errors.Is(err, errConnectionUnusable):
+		status, message = FiringSkipped, err.Error()
+	default:
+		status, message = FiringFailed, err.Error()
+	}
+
+	if _, err := d.DB.ExecContext(ctx, `
+		INSERT INTO schedule_firings (schedule_id, scheduled_for, status, run_id, message)
+		VALUES (?, ?, ?, ?, NULLIF(?, ''))
+	`, scheduleID, scheduledFor, status, runRef, message); err != nil {
+		return fmt.Errorf("record firing: %w", err)
+	}
+	if status != FiringStarted {
+		slog.WarnContext(ctx, "schedule fired without starting a run",
+			"schedule_id", scheduleID, "status", status, "action", action, "reason", message)
+	}
+	return nil
+}
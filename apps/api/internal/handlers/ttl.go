@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+const (
+	// DefaultExpiryInterval is how often the leader looks for deployments to
+	// warn about or expire.
+	DefaultExpiryInterval = time.Minute
+
+	// DefaultExpiryWarning is how long before expiry a deployment is flagged.
+	DefaultExpiryWarning = 24 * time.Hour
+
+	minDeploymentTTL = 15 * time.Minute
+	maxDeploymentTTL = 90 * 24 * time.Hour
+
+	// How long after a failed expiry destroy it is tried again.
+	expiryRetryAfter = time.Hour
+
+	expiryBatchSize = 20
+)
+
+// validTTL checks a TTL given in seconds; 0 means "never expires".
+func validTTL(seconds int64) error {
+	if seconds == 0 {
+		return nil
+	}
+	ttl := time.Duration(seconds) * time.Second
+	if ttl < minDeploymentTTL || ttl > maxDeploymentTTL {
+		return fmt.Errorf("ttlSeconds must be 0 (no expiry) or between %d and %d",
+			int64(minDeploymentTTL/time.Second), int64(maxDeploymentTTL/time.Second))
+	}
+	return nil
+}
+
+// deploymentExpiry resolves when a new deployment expires: its own TTL if
+// given, else the environment's default. nil means it never expires.
+func deploymentExpiry(ctx context.Context, q querier, envID int64, ttlSeconds *int64) (*time.Time, error) {
+	seconds := int64(0)
+	if ttlSeconds != nil {
+		if err := validTTL(*ttlSeconds); err != nil {
+			return nil, err
+		}
+		seconds = *ttlSeconds
+	} else {
+		var def sql.NullInt64
+		if err := q.QueryRowContext(ctx,
+			`SELECT default_ttl_seconds FROM environments WHERE id = ?`, envID,
+		).Scan(&def); err != nil {
+			return nil, err
+		}
+		seconds = def.Int64
+	}
+	if seconds == 0 {
+		return nil, nil
+	}
+	t := time.Now().UTC().Add(time.Duration(seconds) * time.Second)
+	return &t, nil
+}
+
+type ExtendDeploymentReq struct {
+	// Added to the current expiry (or to now, if that has passed)
+	TTLSeconds int64 `json:"ttlSeconds" binding:"required,gt=0"`
+}
+
+// POST /v1/deployments/:id/extend
+// Pushes back an ephemeral deployment's expiry by ttlSeconds and clears its
+// expiry warning. The new expiry may be at most the maximum TTL from now.
+// A deployment whose expiry destroy failed or timed out can be extended too,
+// which calls off the destroy.
+func (d *ServerDeps) ExtendDeployment(c *gin.Context) {
+	deploymentID, ok := idParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid deployment id"})
+		return
+	}
+
+	var req ExtendDeploymentReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	found, err := deploymentInOrg(ctx, d.DB, deploymentID, callerOrgID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		return
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to begin transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		expiresAt       sql.NullTime
+		expiryRunID     sql.NullInt64
+		expiryRunStatus sql.NullString
+	)
+	if err := tx.QueryRowContext(ctx, `
+		SELECT dep.expires_at, dep.expiry_run_id,
+		       (SELECT r.status FROM runs r WHERE r.id = dep.expiry_run_id)
+		FROM deployments dep
+		WHERE dep.id = ?
+		FOR UPDATE
+	`, deploymentID).Scan(&expiresAt, &expiryRunID, &expiryRunStatus); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load deployment"})
+		return
+	}
+	if !expiresAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment does not expire"})
+		return
+	}
+	// A failed expiry destroy left the deployment up; extending it stops the
+	// reaper retrying. Any other expiry run has the deployment going or gone.
+	if expiryRunID.Valid && expiryRunStatus.String != "failed" && expiryRunStatus.String != "timed_out" {
+		c.JSON(http.StatusConflict, gin.H{"error": "deployment has already expired", "runId": expiryRunID.Int64})
+		return
+	}
+
+	now := time.Now().UTC()
+	base := expiresAt.Time
+	if base.Before(now) {
+		base = now
+	}
+	next := base.Add(time.Duration(req.TTLSeconds) * time.Second)
+	if next.After(now.Add(maxDeploymentTTL)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("deployments can't be extended beyond %s from now", maxDeploymentTTL)})
+		return
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE deployments SET expires_at = ?, expiry_warned_at = NULL, expiry_run_id = NULL WHERE id = ?`, next, deploymentID,
+	); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to extend deployment: " + err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to commit transaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deploymentId": deploymentID,
+		"expiresAt":    next,
+	})
+}
+
+// RunExpiryReaper flags deployments that expire within warning and starts
+// destroy runs for those whose TTL has lapsed, every interval until ctx is
+// cancelled. Only the leader acts.
+func (d *ServerDeps) RunExpiryReaper(ctx context.Context, interval, warning time.Duration) {
+	if interval <= 0 {
+		slog.InfoContext(ctx, "deployment expiry disabled")
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if d.isLeader() {
+			d.warnExpiringDeployments(ctx, warning)
+			d.expireDeployments(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// warnExpiringDeployments stamps expiry_warned_at on deployments entering the
+// warning window; the API reports it so owners can extend in time.
+func (d *ServerDeps) warnExpiringDeployments(ctx context.Context, warning time.Duration) {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT id, expires_at FROM deployments
+		WHERE expires_at IS NOT NULL
+		  AND expiry_warned_at IS NULL
+		  AND expiry_run_id IS NULL
+		  AND expires_at <= NOW() + INTERVAL ? SECOND
+	`, int64(warning/time.Second))
+	if err != nil {
+		slog.ErrorContext(ctx, "expiry: query expiring deployments", logging.Err(err))
+		return
+	}
+
+	type expiring struct {
+		id        int64
+		expiresAt time.Time
+	}
+	var list []expiring
+	for rows.Next() {
+		var e expiring
+		if err := rows.Scan(&e.id, &e.expiresAt); err != nil {
+			slog.ErrorContext(ctx, "expiry: scan deployment", logging.Err(err))
+			rows.Close()
+			return
+		}
+		list = append(list, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "expiry: rows error", logging.Err(err))
+		return
+	}
+
+	for _, e := range list {
+		dctx := logging.WithDeployment(ctx, e.id)
+		if _, err := d.DB.ExecContext(ctx,
+			`UPDATE deployments SET expiry_warned_at = NOW() WHERE id = ? AND expiry_warned_at IS NULL`, e.id,
+		); err != nil {
+			slog.ErrorContext(dctx, "mark expiry warning", logging.Err(err))
+			continue
+		}
+		slog.InfoContext(dctx, "deployment expires soon; extend it to keep it",
+			"expires_at", e.expiresAt.Format(time.RFC3339))
+	}
+}
+
+// expireDeployments starts a destroy run for each deployment past its expiry
+// that hasn't got one yet, or whose last one failed over expiryRetryAfter ago.
+func (d *ServerDeps) expireDeployments(ctx context.Context) {
+	rows, err := d.DB.QueryContext(ctx, `
+		SELECT dep.id
+		FROM deployments dep
+		LEFT JOIN runs er ON er.id = dep.expiry_run_id
+		WHERE dep.expires_at <= NOW()
+		  AND (er.id IS NULL
+		       OR (er.status IN ('failed', 'timed_out') AND er.finished_at < NOW() - INTERVAL ? SECOND))
+		ORDER BY dep.expires_at
+		LIMIT ?
+	`, int64(expiryRetryAfter/time.Second), expiryBatchSize)
+	if err != nil {
+		slog.ErrorContext(ctx, "expiry: query expired deployments", logging.Err(err))
+		return
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			slog.ErrorContext(ctx, "expiry: scan deployment", logging.Err(err))
+			rows.Close()
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "expiry: rows error", logging.Err(err))
+		return
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return
+		}
+
+		dctx := logging.WithDeployment(ctx, id)
+		runID, err := d.startDeploymentRun(dctx, id, jobs.ActionDestroy, nil)
+		switch {
+		case errors.Is(err, errNotDeployed):
+			// Nothing left to destroy; stop expiring it.
+			if _, err := d.DB.ExecContext(ctx,
+				`UPDATE deployments SET expires_at = NULL, expiry_warned_at = NULL WHERE id = ?`, id,
+			); err != nil {
+				slog.ErrorContext(dctx, "clear expiry", logging.Err(err))
+			}
+			continue
+		case errors.Is(err, errRunInProgress), errors.Is(err, errConnectionUnusable):
+			slog.WarnContext(dctx, "deployment expired, but can't be destroyed yet; will retry", logging.Err(err))
+			continue
+		case err != nil:
+			slog.ErrorContext(dctx, "start expiry destroy", logging.Err(err))
+			continue
+		}
+
+		if _, err := d.DB.ExecContext(ctx,
+			`UPDATE deployments SET expiry_run_id = ? WHERE id = ?`, runID, id,
+		); err != nil {
+			slog.ErrorContext(logging.WithRun(dctx, runID), "record expiry run", logging.Err(err))
+		}
+		slog.InfoContext(logging.WithRun(dctx, runID), "deployment expired; destroy run started")
+	}
+}
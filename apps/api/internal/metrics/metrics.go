@@ -0,0 +1,135 @@
+// Package metrics defines the API's Prometheus metrics, served on /metrics.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+	"github.com/your-org/aws-infra-platform/packages/platform/awsutil"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aip_api_http_requests_total",
+		Help: "HTTP requests handled, by route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aip_api_http_request_duration_seconds",
+		Help:    "Time taken to handle HTTP requests, by route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	runsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aip_api_runs_enqueued_total",
+		Help: "Jobs pushed onto the worker queue, by action and blueprint.",
+	}, []string{"action", "blueprint"})
+
+	stsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aip_api_sts_request_duration_seconds",
+		Help:    "Latency of STS calls (AssumeRole etc.) including SDK retries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	stsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aip_api_sts_errors_total",
+		Help: "STS calls that failed after the SDK's retries.",
+	}, []string{"operation"})
+)
+
+// Register exports db's connection pool stats and the job queues in Redis,
+// and starts recording STS calls.
+func Register(db *sql.DB, rdb *redis.Client) {
+	prometheus.MustRegister(
+		collectors.NewDBStatsCollector(db, "aip"),
+		&queueCollector{rdb: rdb},
+	)
+
+	awsutil.STSObserver = func(operation string, took time.Duration, err error) {
+		stsDuration.WithLabelValues(operation).Observe(took.Seconds())
+		if err != nil {
+			stsErrors.WithLabelValues(operation).Inc()
+		}
+	}
+}
+
+// Middleware counts and times requests. Requests are labelled with the
+// matched route template (/v1/runs/:id) rather than the path, to keep the
+// number of series bounded.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RunEnqueued counts a job pushed onto the worker queue.
+func RunEnqueued(job jobs.Job) {
+	runsEnqueued.WithLabelValues(job.Action, job.BlueprintKey).Inc()
+}
+
+var (
+	queueDepthDesc = prometheus.NewDesc("aip_jobs_queue_depth",
+		"Jobs waiting on a queue.", []string{"queue"}, nil)
+	queueOldestDesc = prometheus.NewDesc("aip_jobs_queue_oldest_age_seconds",
+		"How long the job at the head of the worker queue has been waiting.", nil, nil)
+	queueUpDesc = prometheus.NewDesc("aip_jobs_queue_up",
+		"Whether the queues could be read from Redis at the last scrape.", nil, nil)
+)
+
+// queueCollector reads the depth of the job queues (including retries not
+// yet due) and the age of the oldest waiting job from Redis at scrape time.
+type queueCollector struct {
+	rdb *redis.Client
+}
+
+func (q *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- queueOldestDesc
+	ch <- queueUpDesc
+}
+
+func (q *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	pipe := q.rdb.Pipeline()
+	depth := pipe.LLen(ctx, jobs.Queue)
+	rejected := pipe.LLen(ctx, jobs.RejectedQueue)
+	delayed := pipe.ZCard(ctx, jobs.DelayedQueue)
+	head := pipe.LIndex(ctx, jobs.Queue, 0) // BLPOP takes from the head
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		ch <- prometheus.MustNewConstMetric(queueUpDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(queueUpDesc, prometheus.GaugeValue, 1)
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(depth.Val()), jobs.Queue)
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(rejected.Val()), jobs.RejectedQueue)
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(delayed.Val()), jobs.DelayedQueue)
+
+	age := 0.0
+	if payload, err := head.Bytes(); err == nil {
+		// Decoding is only for the timestamp; a payload the worker will
+		// reject still counts as waiting, but has no age to report.
+		if job, err := jobs.Decode(payload); err == nil && !job.EnqueuedAt.IsZero() {
+			age = time.Since(job.EnqueuedAt).Seconds()
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(queueOldestDesc, prometheus.GaugeValue, age)
+}
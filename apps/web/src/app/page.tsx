@@ -29,6 +29,10 @@ type AwsConnection = {
   externalId: string;
   region: string;
   nickname?: string;
+  credentialProvider: string;
+  status: string;
+  lastCheckedAt?: string;
+  lastError?: string;
 };
 
 type RunStatusResponse = {
@@ -41,6 +45,13 @@ type RunStatusResponse = {
   summary?: string;
 };
 
+// Envelope returned by every list endpoint (cursor pagination)
+type Page<T> = {
+  items: T[];
+  nextCursor?: string;
+  next?: string;
+};
+
 type DeploymentSummary = {
   id: number;
   blueprintKey: string;
@@ -71,7 +82,6 @@ export default function Home() {
 
   // Add-connection form state
   const [newRoleArn, setNewRoleArn] = useState("");
-  const [newExternalId, setNewExternalId] = useState("");
   const [newRegion, setNewRegion] = useState("ap-northeast-1");
   const [newNickname, setNewNickname] = useState("");
   const [creatingConnection, setCreatingConnection] = useState(false);
@@ -129,11 +139,7 @@ export default function Home() {
               cpu: 256,
               memory: 512,
             },
-            aws: {
-              roleArn: conn.roleArn,
-              externalId: conn.externalId,
-              region: conn.region,
-            },
+            connectionId: conn.id,
           }),
         }
       );
@@ -184,11 +190,7 @@ export default function Home() {
               cpu: 256,
               memory: 512,
             },
-            aws: {
-              roleArn: conn.roleArn,
-              externalId: conn.externalId,
-              region: conn.region,
-            },
+            connectionId: conn.id,
           }),
         }
       );
@@ -243,11 +245,7 @@ export default function Home() {
               db_username: laravelDbUser,
               db_password: laravelDbPassword,
             },
-            aws: {
-              roleArn: conn.roleArn,
-              externalId: conn.externalId,
-              region: conn.region,
-            },
+            connectionId: conn.id,
           }),
         }
       );
@@ -273,25 +271,12 @@ export default function Home() {
     setError(null);
     setResult(null);
 
-    const conn = connections.find((c) => c.id === selectedConnectionId);
-    if (!conn) {
-      setError("Please select an AWS connection before destroying.");
-      return;
-    }
-
+    // The API destroys with the connection the deployment is bound to.
     try {
       const res = await fetch(
         `${process.env.NEXT_PUBLIC_API_BASE}/v1/deployments/${deploymentId}/destroy`,
         {
           method: "POST",
-          headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({
-            aws: {
-              roleArn: conn.roleArn,
-              externalId: conn.externalId,
-              region: conn.region,
-            },
-          }),
         }
       );
 
@@ -324,11 +309,11 @@ export default function Home() {
         throw new Error(`API error ${res.status}: ${text}`);
       }
 
-      const json = (await res.json()) as AwsConnection[];
-      setConnections(json);
+      const json = (await res.json()) as Page<AwsConnection>;
+      setConnections(json.items);
 
-      if (json.length > 0 && selectedConnectionId === null) {
-        setSelectedConnectionId(json[0].id);
+      if (json.items.length > 0 && selectedConnectionId === null) {
+        setSelectedConnectionId(json.items[0].id);
       }
     } catch (err: any) {
       setConnectionsError(err.message || "Failed to load connections");
@@ -350,7 +335,6 @@ export default function Home() {
           headers: { "Content-Type": "application/json" },
           body: JSON.stringify({
             roleArn: newRoleArn,
-            externalId: newExternalId,
             region: newRegion,
             nickname: newNickname || undefined,
           }),
@@ -366,10 +350,11 @@ export default function Home() {
 
       setConnections((prev) => [created, ...prev]);
       setSelectedConnectionId(created.id);
-      setCreateConnectionSuccess("AWS connection created successfully");
+      setCreateConnectionSuccess(
+        `Connection created (pending). Apply the trust policy with External ID ${created.externalId}, then call POST /v1/connections/aws/${created.id}/verify.`
+      );
 
       setNewRoleArn("");
-      setNewExternalId("");
       setNewNickname("");
     } catch (err: any) {
       setCreateConnectionError(err.message || "Failed to create connection");
@@ -423,8 +408,8 @@ export default function Home() {
         throw new Error(`API error ${res.status}: ${text}`);
       }
 
-      const json = (await res.json()) as DeploymentSummary[];
-      setDeployments(json);
+      const json = (await res.json()) as Page<DeploymentSummary>;
+      setDeployments(json.items);
     } catch (err: any) {
       setDeploymentsError(err.message || "Failed to load deployments");
     } finally {
@@ -574,13 +559,6 @@ export default function Home() {
               onChange={(e) => setNewRoleArn(e.target.value)}
               fullWidth
             />
-            <TextField
-              label="External ID"
-              placeholder="aip-dev-external-id"
-              value={newExternalId}
-              onChange={(e) => setNewExternalId(e.target.value)}
-              fullWidth
-            />
             <TextField
               label="Region"
               value={newRegion}
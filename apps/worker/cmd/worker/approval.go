@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// errAwaitingApproval is returned for an apply parked after its plan step; the
+// run is neither succeeded nor failed until approvers decide.
+var errAwaitingApproval = errors.New("awaiting approval")
+
+// runTerraformPlanForApproval plans an apply and saves the plan under
+// jobs.PlanKey for the apply step. It reports whether the plan has changes;
+// one without any needs no approval.
+func runTerraformPlanForApproval(ctx context.Context, rdb *redis.Client, modulePath string, job *jobs.Job) (string, bool, error) {
+	// Credentials for this job, from the connection's provider (job.AWS)
+	creds, err := credentialsForJob(ctx, job)
+	if err != nil {
+		return "", false, fmt.Errorf("resolve credentials failed: %w", err)
+	}
+
+	env := creds.Env()
+
+	slog.InfoContext(ctx, "planning apply for approval", "module", modulePath, "credential_provider", providerName(job), "region", creds.Region)
+
+	tctx, cancel := context.WithTimeout(ctx, jobTimeout(job))
+	defer cancel()
+
+	// 1) terraform init
+	if err := runTerraformCmd(tctx, modulePath, env, "init", "-input=false", "-no-color"); err != nil {
+		return "", false, fmt.Errorf("terraform init failed: %w", err)
+	}
+
+	varArgs := []string{}
+	for k, v := range job.Inputs {
+		varArgs = append(varArgs, "-var", fmt.Sprintf("%s=%v", k, v))
+	}
+
+	tmp, err := os.MkdirTemp("", fmt.Sprintf("aip-apply-%d-", job.RunID))
+	if err != nil {
+		return "", false, err
+	}
+	defer os.RemoveAll(tmp)
+	planFile := filepath.Join(tmp, "apply.tfplan")
+
+	// 2) terraform plan -detailed-exitcode -out (exit 2: has changes)
+	args := append([]string{"plan", "-input=false", "-no-color", "-detailed-exitcode", "-out=" + planFile}, varArgs...)
+	cmd := terraformCommand(tctx, modulePath, env, args...)
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = io.MultiWriter(cmd.Stdout, &out)
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
+
+	changes := false
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+			return "", false, fmt.Errorf("terraform plan failed: %w", terraformFailure(tctx, err, stderr.String()))
+		}
+		changes = true
+	}
+
+	summary := ""
+	if matches := summaryLineRE.FindAllString(out.String(), -1); len(matches) > 0 {
+		summary = strings.TrimSpace(matches[len(matches)-1])
+	}
+	if !changes {
+		return summary, false, nil
+	}
+
+	// 3) Keep the plan for the apply step
+	plan, err := os.ReadFile(planFile)
+	if err != nil {
+		return "", false, err
+	}
+	if err := rdb.Set(ctx, jobs.PlanKey(job.RunID), plan, jobs.MaxPlanAge).Err(); err != nil {
+		return "", false, fmt.Errorf("save plan: %w", err)
+	}
+	return summary, true, nil
+}
+
+// runTerraformApplyPlan applies the plan saved by the run's plan step, so
+// exactly what was approved is applied. Terraform refuses the plan if state
+// has changed since.
+func runTerraformApplyPlan(ctx context.Context, rdb *redis.Client, modulePath string, job *jobs.Job) (string, error) {
+	plan, err := rdb.Get(ctx, jobs.PlanKey(job.RunID)).Bytes()
+	if err == redis.Nil {
+		return "", errors.New("saved plan not found; it may have expired")
+	}
+	if err != nil {
+		return "", fmt.Errorf("load saved plan: %w", err)
+	}
+
+	// Credentials for this job, from the connection's provider (job.AWS)
+	creds, err := credentialsForJob(ctx, job)
+	if err != nil {
+		return "", fmt.Errorf("resolve credentials failed: %w", err)
+	}
+
+	env := creds.Env()
+
+	slog.InfoContext(ctx, "applying approved plan", "module", modulePath, "credential_provider", providerName(job), "region", creds.Region)
+
+	tmp, err := os.MkdirTemp("", fmt.Sprintf("aip-apply-%d-", job.RunID))
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	planFile := filepath.Join(tmp, "apply.tfplan")
+	if err := os.WriteFile(planFile, plan, 0o600); err != nil {
+		return "", err
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, jobTimeout(job))
+	defer cancel()
+
+	// 1) terraform init
+	if err := runTerraformCmd(tctx, modulePath, env, "init", "-input=false", "-no-color"); err != nil {
+		return "", fmt.Errorf("terraform init failed: %w", err)
+	}
+
+	// 2) terraform apply <plan>; a saved plan needs no -auto-approve or -var
+	summary, err := runTerraformCmdWithSummary(tctx, modulePath, env, "apply", "-input=false", "-no-color", planFile)
+	if err != nil {
+		return "", fmt.Errorf("terraform apply failed: %w", err)
+	}
+
+	if err := rdb.Del(ctx, jobs.PlanKey(job.RunID)).Err(); err != nil {
+		slog.WarnContext(ctx, "delete applied plan", logging.Err(err))
+	}
+	return summary, nil
+}
+
+// markRunAwaitingApproval parks a planned apply with its plan summary. The
+// approval window is the environment's, capped by how long plans are kept.
+func markRunAwaitingApproval(ctx context.Context, db *sql.DB, runID int64, summary string) error {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx2, `
+		UPDATE runs r
+		JOIN deployments dep ON dep.id = r.deployment_id
+		JOIN environments e ON e.id = dep.environment_id
+		SET r.status = 'awaiting_approval',
+		    r.summary = NULLIF(?, ''),
+		    r.approval_expires_at = NOW() + INTERVAL LEAST(e.approval_ttl_seconds, ?) SECOND
+		WHERE r.id = ?
+	`, summary, int64(jobs.MaxPlanAge/time.Second), runID)
+	return err
+}
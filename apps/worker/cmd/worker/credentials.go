@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/awsutil"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+const (
+	defaultJobRegion   = "ap-northeast-1"
+	runSessionDuration = 3600 // seconds
+)
+
+// CredentialProvider obtains the AWS credentials a job's terraform runs with.
+type CredentialProvider interface {
+	Retrieve(ctx context.Context, job *jobs.Job) (*AWSCredentials, error)
+}
+
+// Env returns the AWS_* variables terraform and the AWS provider read.
+func (c *AWSCredentials) Env() []string {
+	env := []string{
+		"AWS_ACCESS_KEY_ID=" + c.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY=" + c.SecretAccessKey,
+		"AWS_REGION=" + c.Region,
+	}
+	if c.SessionToken != "" {
+		env = append(env, "AWS_SESSION_TOKEN="+c.SessionToken)
+	}
+	return env
+}
+
+// credentialProviderFor picks the provider named by the job's connection.
+// Jobs from before providers existed carry none and use direct AssumeRole.
+func credentialProviderFor(job *jobs.Job) (CredentialProvider, error) {
+	switch name := providerName(job); name {
+	case awsutil.ProviderAssumeRole:
+		return assumeRoleProvider{}, nil
+	case awsutil.ProviderHubChain:
+		return hubChainProvider{}, nil
+	case awsutil.ProviderWebIdentity:
+		return webIdentityProvider{TokenFile: os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")}, nil
+	case awsutil.ProviderStatic:
+		return staticProvider{
+			AccessKeyID:     os.Getenv("AIP_STATIC_AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AIP_STATIC_AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AIP_STATIC_AWS_SESSION_TOKEN"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown credential provider %q", name)
+	}
+}
+
+// credentialsForJob resolves the job's credentials with its connection's provider.
+func credentialsForJob(ctx context.Context, job *jobs.Job) (creds *AWSCredentials, err error) {
+	ctx, span := tracer.Start(ctx, "resolve credentials",
+		trace.WithAttributes(attribute.String("aip.credential_provider", providerName(job))))
+	defer func() { endSpan(span, err) }()
+
+	// The API checks this too; don't hand tokens or keys to an endpoint
+	// that got past it.
+	if err := awsutil.ValidSTSEndpoint(job.AWS.STSEndpoint); err != nil {
+		return nil, err
+	}
+	p, err := credentialProviderFor(job)
+	if err != nil {
+		return nil, err
+	}
+	return p.Retrieve(ctx, job)
+}
+
+func jobRegion(job *jobs.Job) string {
+	if r := job.AWS.Region; r != "" {
+		return r
+	}
+	return defaultJobRegion
+}
+
+func runSessionName(job *jobs.Job) string {
+	return fmt.Sprintf("aip-run-%d", job.RunID)
+}
+
+// assumeTargetRole assumes the job's role with the given STS client.
+func assumeTargetRole(ctx context.Context, client *sts.Client, job *jobs.Job) (*AWSCredentials, error) {
+	roleArn := job.AWS.RoleArn
+	externalID := job.AWS.ExternalID
+	if roleArn == "" || externalID == "" {
+		return nil, fmt.Errorf("missing roleArn or externalId in job.aws")
+	}
+
+	out, err := client.AssumeRole(ctx, &sts.AssumeRoleInput{
+		RoleArn:         aws.String(roleArn),
+		RoleSessionName: aws.String(runSessionName(job)),
+		ExternalId:      aws.String(externalID),
+		DurationSeconds: aws.Int32(runSessionDuration),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("STS AssumeRole error: %w", err)
+	}
+	if out.Credentials == nil {
+		return nil, fmt.Errorf("STS AssumeRole returned nil credentials")
+	}
+
+	return &AWSCredentials{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Region:          jobRegion(job),
+	}, nil
+}
+
+// assumeRoleProvider assumes the target role directly with the worker's own
+// credentials (AWS_PROFILE / env / instance role).
+type assumeRoleProvider struct{}
+
+func (assumeRoleProvider) Retrieve(ctx context.Context, job *jobs.Job) (*AWSCredentials, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(jobRegion(job)))
+	if err != nil {
+		return nil, fmt.Errorf("load default AWS config: %w", err)
+	}
+	return assumeTargetRole(ctx, awsutil.NewSTSClient(cfg, job.AWS.STSEndpoint), job)
+}
+
+// hubChainProvider first assumes a role in a hub account that the target
+// account trusts, then assumes the target role from there. Use it for
+// accounts the platform role can't reach directly.
+type hubChainProvider struct{}
+
+func (hubChainProvider) Retrieve(ctx context.Context, job *jobs.Job) (*AWSCredentials, error) {
+	hubRoleArn := job.AWS.HubRoleArn
+	if hubRoleArn == "" {
+		return nil, fmt.Errorf("missing hubRoleArn in job.aws")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(jobRegion(job)))
+	if err != nil {
+		return nil, fmt.Errorf("load default AWS config: %w", err)
+	}
+
+	cfg = awsutil.ViaHubRole(cfg, job.AWS.STSEndpoint, hubRoleArn, job.AWS.HubExternalID, runSessionName(job)+"-hub")
+
+	creds, err := assumeTargetRole(ctx, awsutil.NewSTSClient(cfg, job.AWS.STSEndpoint), job)
+	if err != nil {
+		return nil, fmt.Errorf("via hub role %s: %w", hubRoleArn, err)
+	}
+	return creds, nil
+}
+
+// webIdentityProvider exchanges the worker's OIDC token (e.g. an EKS service
+// account token) for the target role via AssumeRoleWithWebIdentity. The role
+// must trust the worker's identity provider; external IDs don't apply.
+type webIdentityProvider struct {
+	TokenFile string
+}
+
+func (p webIdentityProvider) Retrieve(ctx context.Context, job *jobs.Job) (*AWSCredentials, error) {
+	roleArn := job.AWS.RoleArn
+	if roleArn == "" {
+		return nil, fmt.Errorf("missing roleArn in job.aws")
+	}
+	if p.TokenFile == "" {
+		return nil, fmt.Errorf("web identity provider: AWS_WEB_IDENTITY_TOKEN_FILE is not set")
+	}
+
+	// No credentials needed to call AssumeRoleWithWebIdentity.
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(jobRegion(job)),
+		config.WithCredentialsProvider(aws.AnonymousCredentials{}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load default AWS config: %w", err)
+	}
+
+	provider := stscreds.NewWebIdentityRoleProvider(
+		awsutil.NewSTSClient(cfg, job.AWS.STSEndpoint),
+		roleArn,
+		stscreds.IdentityTokenFile(p.TokenFile),
+		func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = runSessionName(job)
+		},
+	)
+	v, err := provider.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("STS AssumeRoleWithWebIdentity error: %w", err)
+	}
+
+	return &AWSCredentials{
+		AccessKeyID:     v.AccessKeyID,
+		SecretAccessKey: v.SecretAccessKey,
+		SessionToken:    v.SessionToken,
+		Region:          jobRegion(job),
+	}, nil
+}
+
+// staticProvider hands terraform fixed keys from the worker's environment
+// (AIP_STATIC_AWS_*). For local testing against sandboxes or emulators only.
+type staticProvider struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+func (p staticProvider) Retrieve(ctx context.Context, job *jobs.Job) (*AWSCredentials, error) {
+	if p.AccessKeyID == "" || p.SecretAccessKey == "" {
+		return nil, fmt.Errorf("static provider: AIP_STATIC_AWS_ACCESS_KEY_ID and AIP_STATIC_AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return &AWSCredentials{
+		AccessKeyID:     p.AccessKeyID,
+		SecretAccessKey: p.SecretAccessKey,
+		SessionToken:    p.SessionToken,
+		Region:          jobRegion(job),
+	}, nil
+}
+
+// providerName is the job's credential provider for log lines.
+func providerName(job *jobs.Job) string {
+	if name := job.AWS.CredentialProvider; name != "" {
+		return name
+	}
+	return awsutil.ProviderAssumeRole
+}
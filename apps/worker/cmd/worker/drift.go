@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+// DriftReport is what a drift run records on deployments.drift_details_json.
+type DriftReport struct {
+	// Resources changed outside terraform since the last apply
+	ResourceDrift []DriftedResource `json:"resourceDrift"`
+	// What an apply would do to bring them back in line with the config
+	PlannedChanges []DriftedResource `json:"plannedChanges"`
+}
+
+type DriftedResource struct {
+	Address string   `json:"address"`
+	Actions []string `json:"actions"`
+}
+
+// tfPlanJSON is the subset of `terraform show -json <planfile>` we read.
+type tfPlanJSON struct {
+	ResourceDrift   []tfResourceChange `json:"resource_drift"`
+	ResourceChanges []tfResourceChange `json:"resource_changes"`
+}
+
+type tfResourceChange struct {
+	Address string `json:"address"`
+	Change  struct {
+		Actions []string `json:"actions"`
+	} `json:"change"`
+}
+
+// runTerraformDrift refreshes state and plans with -detailed-exitcode: exit 0
+// means the deployment matches its config, exit 2 means it has drifted. The
+// report lists what changed outside terraform and what an apply would do.
+func runTerraformDrift(ctx context.Context, modulePath string, job *jobs.Job) (string, bool, *DriftReport, error) {
+	// Credentials for this job, from the connection's provider (job.AWS)
+	creds, err := credentialsForJob(ctx, job)
+	if err != nil {
+		return "", false, nil, fmt.Errorf("resolve credentials failed: %w", err)
+	}
+
+	env := creds.Env()
+
+	slog.InfoContext(ctx, "running terraform drift check", "module", modulePath, "credential_provider", providerName(job), "region", creds.Region)
+
+	tctx, cancel := context.WithTimeout(ctx, jobTimeout(job))
+	defer cancel()
+
+	// 1) terraform init
+	if err := runTerraformCmd(tctx, modulePath, env, "init", "-input=false", "-no-color"); err != nil {
+		return "", false, nil, fmt.Errorf("terraform init failed: %w", err)
+	}
+
+	varArgs := []string{}
+	for k, v := range job.Inputs {
+		varArgs = append(varArgs, "-var", fmt.Sprintf("%s=%v", k, v))
+	}
+
+	// The plan file lives outside the module so concurrent runs don't collide.
+	tmp, err := os.MkdirTemp("", fmt.Sprintf("aip-drift-%d-", job.RunID))
+	if err != nil {
+		return "", false, nil, err
+	}
+	defer os.RemoveAll(tmp)
+	planFile := filepath.Join(tmp, "drift.tfplan")
+
+	// 2) terraform plan -refresh=true -detailed-exitcode
+	args := append([]string{"plan", "-input=false", "-no-color", "-refresh=true", "-detailed-exitcode", "-out=" + planFile}, varArgs...)
+	cmd := terraformCommand(tctx, modulePath, env, args...)
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = io.MultiWriter(cmd.Stdout, &out)
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
+
+	drifted := false
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+			return "", false, nil, fmt.Errorf("terraform plan failed: %w", terraformFailure(tctx, err, stderr.String()))
+		}
+		drifted = true
+	}
+
+	summary := "No drift"
+	if drifted {
+		summary = "Drift detected"
+	}
+	if matches := summaryLineRE.FindAllString(out.String(), -1); len(matches) > 0 {
+		summary += ": " + strings.TrimSpace(matches[len(matches)-1])
+	}
+
+	// 3) terraform show -json for the per-resource report
+	show := terraformCommand(tctx, modulePath, env, "show", "-json", planFile)
+	raw, err := show.Output()
+	if err != nil {
+		return "", false, nil, fmt.Errorf("terraform show -json failed: %w", err)
+	}
+
+	var plan tfPlanJSON
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return "", false, nil, fmt.Errorf("decode plan json: %w", err)
+	}
+
+	report := &DriftReport{
+		ResourceDrift:  changedResources(plan.ResourceDrift),
+		PlannedChanges: changedResources(plan.ResourceChanges),
+	}
+	return summary, drifted, report, nil
+}
+
+// changedResources drops no-op and read-only entries.
+func changedResources(changes []tfResourceChange) []DriftedResource {
+	out := []DriftedResource{}
+	for _, rc := range changes {
+		a := rc.Change.Actions
+		if slices.Equal(a, []string{"no-op"}) || slices.Equal(a, []string{"read"}) {
+			continue
+		}
+		out = append(out, DriftedResource{Address: rc.Address, Actions: a})
+	}
+	return out
+}
+
+// persistDriftForRun records a drift run's result on its deployment.
+func persistDriftForRun(ctx context.Context, db *sql.DB, runID int64, drifted bool, report *DriftReport) error {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	details, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx2, `
+		UPDATE deployments dep
+		JOIN runs r ON r.deployment_id = dep.id
+		SET dep.drifted = ?,
+		    dep.drift_details_json = ?,
+		    dep.drift_checked_at = NOW()
+		WHERE r.id = ?
+	`, drifted, string(details), runID)
+	if err != nil {
+		return fmt.Errorf("update drift for run %d: %w", runID, err)
+	}
+	return nil
+}
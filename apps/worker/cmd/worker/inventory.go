@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// tfStateJSON is the subset of `terraform show -json` (without a plan file,
+// i.e. the current state) we read.
+type tfStateJSON struct {
+	Values *struct {
+		RootModule tfStateModule `json:"root_module"`
+	} `json:"values"`
+}
+
+type tfStateModule struct {
+	Resources    []tfStateResource `json:"resources"`
+	ChildModules []tfStateModule   `json:"child_modules"`
+}
+
+type tfStateResource struct {
+	Address string         `json:"address"`
+	Mode    string         `json:"mode"` // "managed" or "data"
+	Type    string         `json:"type"`
+	Values  map[string]any `json:"values"`
+}
+
+// inventoryResource is a row of the resources table.
+type inventoryResource struct {
+	ARN     string
+	Address string
+	Type    string
+	Name    string
+	Region  string
+	Tags    map[string]string
+}
+
+// captureTerraformState runs `terraform show -json` in the run's working
+// directory and returns the managed resources in state that have an ARN. Resources
+// without one (attachments, rules) aren't inventoried.
+func captureTerraformState(ctx context.Context, modulePath string, job *jobs.Job) ([]inventoryResource, error) {
+	creds, err := credentialsForJob(ctx, job)
+	if err != nil {
+		return nil, fmt.Errorf("resolve credentials for state failed: %w", err)
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	cmd := terraformCommand(tctx, modulePath, creds.Env(), "show", "-json", "-no-color")
+	raw, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = terraformFailure(tctx, err, string(exitErr.Stderr))
+		}
+		return nil, fmt.Errorf("terraform show -json failed: %w", err)
+	}
+
+	var state tfStateJSON
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return nil, fmt.Errorf("decode state: %w", err)
+	}
+	if state.Values == nil {
+		return nil, nil // empty state, e.g. after destroy
+	}
+	return stateResources(state.Values.RootModule, nil), nil
+}
+
+// stateResources collects the inventoried resources of a module and its
+// children.
+func stateResources(m tfStateModule, out []inventoryResource) []inventoryResource {
+	for _, r := range m.Resources {
+		arn, _ := r.Values["arn"].(string)
+		if r.Mode != "managed" || !strings.HasPrefix(arn, "arn:") {
+			continue
+		}
+		res := inventoryResource{
+			ARN:     arn,
+			Address: r.Address,
+			Type:    r.Type,
+			Tags:    stateTags(r.Values),
+		}
+		// Region is the ARN's fourth field; empty for global services (IAM)
+		if parts := strings.SplitN(arn, ":", 5); len(parts) == 5 {
+			res.Region = parts[3]
+		}
+		if name, ok := r.Values["name"].(string); ok && name != "" {
+			res.Name = name
+		} else {
+			res.Name = res.Tags["Name"]
+		}
+		out = append(out, res)
+	}
+	for _, child := range m.ChildModules {
+		out = stateResources(child, out)
+	}
+	return out
+}
+
+// stateTags reads a resource's tags, including those inherited from the
+// provider's default_tags (tags_all) when present.
+func stateTags(values map[string]any) map[string]string {
+	raw, ok := values["tags_all"].(map[string]any)
+	if !ok {
+		raw, _ = values["tags"].(map[string]any)
+	}
+	tags := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			tags[k] = s
+		}
+	}
+	return tags
+}
+
+// persistResourcesForRun makes the run's deployment's resources match
+// resources: rows are upserted by ARN (unique per deployment through the
+// arn_hash column, as ARNs are too long to index whole) and rows for
+// resources no longer in state are deleted.
+func persistResourcesForRun(ctx context.Context, db *sql.DB, runID int64, resources []inventoryResource) error {
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := db.BeginTx(ctx2, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var deploymentID int64
+	if err := tx.QueryRowContext(ctx2,
+		"SELECT deployment_id FROM runs WHERE id = ?",
+		runID,
+	).Scan(&deploymentID); err != nil {
+		return fmt.Errorf("lookup deployment_id for run %d: %w", runID, err)
+	}
+
+	keep := make([]any, 0, len(resources)+1)
+	keep = append(keep, deploymentID)
+	for _, r := range resources {
+		tags, err := json.Marshal(r.Tags)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx2, `
+			INSERT INTO resources (deployment_id, arn, address, type, name, region, tags_json, last_run_id)
+			VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?)
+			ON DUPLICATE KEY UPDATE
+			    address = VALUES(address),
+			    type = VALUES(type),
+			    name = VALUES(name),
+			    region = VALUES(region),
+			    tags_json = VALUES(tags_json),
+			    last_run_id = VALUES(last_run_id)
+		`, deploymentID, r.ARN, r.Address, r.Type, r.Name, r.Region, string(tags), runID)
+		if err != nil {
+			return fmt.Errorf("upsert resource %s: %w", r.Address, err)
+		}
+		keep = append(keep, r.ARN)
+	}
+
+	gone := "DELETE FROM resources WHERE deployment_id = ?"
+	if len(resources) > 0 {
+		gone += " AND arn NOT IN (?" + strings.Repeat(", ?", len(resources)-1) + ")"
+	}
+	res, err := tx.ExecContext(ctx2, gone, keep...)
+	if err != nil {
+		return fmt.Errorf("delete removed resources: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	removed, _ := res.RowsAffected()
+	slog.InfoContext(ctx, "resource inventory updated", "resources", len(resources), "removed", removed)
+	return nil
+}
+
+// syncInventory refreshes the deployment's resource inventory from state
+// after an apply or destroy. It is best-effort: the run's outcome doesn't
+// depend on it, and the next apply or destroy syncs again.
+func syncInventory(ctx context.Context, db *sql.DB, modulePath string, job *jobs.Job) {
+	resources, err := captureTerraformState(ctx, modulePath, job)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to read state for the resource inventory", logging.Err(err))
+		return
+	}
+	if err := persistResourcesForRun(ctx, db, job.RunID, resources); err != nil {
+		slog.ErrorContext(ctx, "failed to persist resource inventory", logging.Err(err))
+	}
+}
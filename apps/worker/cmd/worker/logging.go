@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// jobLogContext returns ctx with the lines logged under it attributed to the
+// job's run, the API request that started it and the deployment, org and
+// user it belongs to. The run's deployment is looked up; if that fails the
+// lines still carry the run and request.
+func jobLogContext(ctx context.Context, db *sql.DB, job *jobs.Job) context.Context {
+	ctx = logging.WithRun(ctx, job.RunID)
+	if job.RequestID != "" {
+		ctx = logging.With(ctx, slog.String(logging.KeyRequestID, job.RequestID))
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var (
+		deploymentID, orgID int64
+		userID              sql.NullInt64
+	)
+	err := db.QueryRowContext(ctx2, `
+		SELECT r.deployment_id, p.org_id, r.triggered_by
+		FROM runs r
+		JOIN deployments dep ON dep.id = r.deployment_id
+		JOIN environments e ON e.id = dep.environment_id
+		JOIN projects p ON p.id = e.project_id
+		WHERE r.id = ?
+	`, job.RunID).Scan(&deploymentID, &orgID, &userID)
+	if err != nil {
+		slog.WarnContext(ctx, "look up run's deployment for logging", logging.Err(err))
+		return ctx
+	}
+
+	attrs := []slog.Attr{
+		slog.Int64(logging.KeyDeploymentID, deploymentID),
+		slog.Int64(logging.KeyOrgID, orgID),
+	}
+	if userID.Valid {
+		attrs = append(attrs, slog.Int64(logging.KeyUserID, userID.Int64))
+	}
+	return logging.With(ctx, attrs...)
+}
+
+// logWriter logs each line written to it as a record, so terraform's output
+// is part of the structured log (and attributed to the run) rather than
+// interleaved with it on stdout. Call Flush once the writes are done.
+type logWriter struct {
+	ctx   context.Context
+	level slog.Level
+	attrs []slog.Attr
+	buf   []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs a final line not ended by a newline.
+func (w *logWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.log(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *logWriter) log(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	slog.LogAttrs(w.ctx, w.level, string(line), w.attrs...)
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
@@ -1,30 +1,30 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
 	redis "github.com/redis/go-redis/v9"
-)
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 
-type Job struct {
-	RunID        int64             `json:"run_id"`
-	Action       string            `json:"action"`
-	BlueprintKey string            `json:"blueprint_key"`
-	Version      string            `json:"version"`
-	Inputs       map[string]any    `json:"inputs"`
-	AWS          map[string]string `json:"aws"` // expects roleArn, externalId, region
-}
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+	"github.com/your-org/aws-infra-platform/packages/platform/tracing"
+)
 
 type AWSCredentials struct {
 	AccessKeyID     string
@@ -34,39 +34,68 @@ type AWSCredentials struct {
 }
 
 func main() {
+	if _, err := logging.Setup("aip-worker"); err != nil {
+		log.Fatal(err)
+	}
+
 	redisAddr := getEnv("REDIS_ADDR", "127.0.0.1:6379")
 	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
 	defer rdb.Close()
 
 	// DB for updating runs table
 	dsn := getEnv("MYSQL_DSN", "aip:aip@tcp(127.0.0.1:3306)/aws_infra_platform?parseTime=true&multiStatements=true")
-	db, err := sql.Open("mysql", dsn)
+	db, err := otelsql.Open("mysql", dsn,
+		otelsql.WithAttributes(semconv.DBSystemNameMySQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 	if err != nil {
-		log.Fatalf("failed to open db: %v", err)
+		fatal("failed to open db", err)
 	}
 	db.SetConnMaxLifetime(3 * time.Minute)
 	db.SetMaxOpenConns(10)
 	db.SetMaxIdleConns(10)
 	if err := db.Ping(); err != nil {
-		log.Fatalf("db ping failed: %v", err)
+		fatal("db ping failed", err)
 	}
 	defer db.Close()
 
 	ctx := context.Background()
 
+	shutdownTracing, err := tracing.Setup(ctx, "aip-worker")
+	if err != nil {
+		fatal("tracing setup failed", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	if err := rdb.Ping(ctx).Err(); err != nil {
-		log.Fatalf("redis ping failed: %v", err)
+		fatal("redis ping failed", err)
+	}
+
+	if err := loadTimeouts(); err != nil {
+		fatal("invalid timeout config", err)
+	}
+	if err := loadStateRoot(); err != nil {
+		fatal("invalid state dir", err)
 	}
+	policy, err := loadRetryPolicy()
+	if err != nil {
+		fatal("invalid retry config", err)
+	}
+
+	serveMetrics(getEnv("METRICS_ADDR", ":9091"), db)
 
-	log.Printf("worker listening on queue aip:jobs (redis=%s)", redisAddr)
+	slog.Info("worker listening", "queue", jobs.Queue, "redis", redisAddr,
+		"contract_versions", fmt.Sprintf("v%d..v%d", jobs.MinContractVersion, jobs.ContractVersion))
 
 	for {
-		res, err := rdb.BLPop(ctx, 5*time.Second, "aip:jobs").Result()
+		promoteDueRetries(ctx, rdb)
+
+		res, err := rdb.BLPop(ctx, 5*time.Second, jobs.Queue).Result()
 		if err == redis.Nil {
 			continue // timeout, just loop again
 		}
 		if err != nil {
-			log.Printf("BLPop error: %v", err)
+			slog.ErrorContext(ctx, "BLPop failed", logging.Err(err))
 			time.Sleep(time.Second)
 			continue
 		}
@@ -75,101 +104,159 @@ func main() {
 			continue
 		}
 
-		var job Job
-		if err := json.Unmarshal([]byte(res[1]), &job); err != nil {
-			log.Printf("decode job error: %v", err)
+		job, err := jobs.Decode([]byte(res[1]))
+		if err != nil {
+			rejectJob(ctx, rdb, db, res[1], err)
 			continue
 		}
 
-		log.Printf("job: run=%d action=%s blueprint=%s@%s", job.RunID, job.Action, job.BlueprintKey, job.Version)
+		observeRunStarted(job)
+		ctx, span := startJobSpan(jobLogContext(ctx, db, job), job)
+		slog.InfoContext(ctx, "job received", "action", job.Action, "step", job.Step,
+			"blueprint", job.BlueprintKey+"@"+job.Version)
 
 		// Mark run as running
 		if err := markRunRunning(ctx, db, job.RunID); err != nil {
-			log.Printf("failed to mark run %d running: %v", job.RunID, err)
+			slog.ErrorContext(ctx, "failed to mark run running", logging.Err(err))
 		}
 
-		if err := handleJob(ctx, db, &job); err != nil {
-			log.Printf("job %d failed: %v", job.RunID, err)
+		summary, err := runAttempt(ctx, rdb, db, policy, job)
+		if errors.Is(err, errRetryScheduled) {
+			observeRunFinished(job, "queued")
+			if err2 := markRunQueued(ctx, db, job.RunID); err2 != nil {
+				slog.ErrorContext(ctx, "failed to mark run queued", logging.Err(err2))
+			}
+		} else if errors.Is(err, errAwaitingApproval) {
+			slog.InfoContext(ctx, "job planned; awaiting approval")
+			observeRunFinished(job, "awaiting_approval")
+		} else if errors.Is(err, errTimedOut) {
+			slog.ErrorContext(ctx, "job timed out", logging.Err(err))
+			observeRunFinished(job, "timed_out")
+			if err2 := markRunTimedOut(ctx, db, job.RunID, fmt.Sprintf("%v (timeout %s)", err, jobTimeout(job))); err2 != nil {
+				slog.ErrorContext(ctx, "failed to mark run timed out", logging.Err(err2))
+			}
+		} else if err != nil {
+			slog.ErrorContext(ctx, "job failed", logging.Err(err))
+			observeRunFinished(job, "failed")
 			if err2 := markRunFailed(ctx, db, job.RunID, err.Error()); err2 != nil {
-				log.Printf("failed to mark run %d failed: %v", job.RunID, err2)
+				slog.ErrorContext(ctx, "failed to mark run failed", logging.Err(err2))
 			}
 		} else {
-			log.Printf("job %d completed successfully", job.RunID)
-			if err := markRunSucceeded(ctx, db, job.RunID); err != nil {
-				log.Printf("failed to mark run %d succeeded: %v", job.RunID, err)
+			slog.InfoContext(ctx, "job completed successfully", "summary", summary)
+			observeRunFinished(job, "succeeded")
+			if err := markRunSucceeded(ctx, db, job.RunID, summary); err != nil {
+				slog.ErrorContext(ctx, "failed to mark run succeeded", logging.Err(err))
 			}
 		}
+		endSpan(span, err)
 	}
 }
 
-// handleJob now has access to the DB so we can persist outputs on apply
-func handleJob(ctx context.Context, db *sql.DB, job *Job) error {
+// handleJob has access to the DB so we can persist outputs and the resource
+// inventory after applies and destroys.
+// It returns the terraform summary line to record on the run, or
+// errAwaitingApproval once a gated apply has been planned and parked.
+func handleJob(ctx context.Context, rdb *redis.Client, db *sql.DB, job *jobs.Job) (string, error) {
+	dir, cleanup, err := newWorkdir(ctx, db, job)
+	if err != nil {
+		return "", fmt.Errorf("prepare working directory: %w", err)
+	}
+	defer cleanup()
+
 	switch job.Action {
-	case "plan":
-		return runTerraformPlan(ctx, job)
+	case jobs.ActionPlan:
+		return runTerraformPlan(ctx, dir, job)
+
+	case jobs.ActionApply:
+		switch job.Step {
+		case jobs.StepPlanForApproval:
+			summary, changes, err := runTerraformPlanForApproval(ctx, rdb, dir, job)
+			if err != nil || !changes {
+				return summary, err
+			}
+			if err := markRunAwaitingApproval(ctx, db, job.RunID, summary); err != nil {
+				return "", fmt.Errorf("mark awaiting approval: %w", err)
+			}
+			return summary, errAwaitingApproval
+		}
 
-	case "apply":
-		// 1) Run apply
-		if err := runTerraformApply(ctx, job); err != nil {
-			return err
+		// 1) Run apply (of the approved plan, for a gated apply)
+		var (
+			summary string
+			err     error
+		)
+		if job.Step == jobs.StepApplyPlan {
+			summary, err = runTerraformApplyPlan(ctx, rdb, dir, job)
+		} else {
+			summary, err = runTerraformApply(ctx, dir, job)
 		}
 
-	case "destroy":
-		// 1) Run destroy
-		if err := runTerraformDestroy(ctx, job); err != nil {
-			return err
+		// 2) Best-effort: record what's in state now, including anything a
+		// failed apply created before it stopped
+		syncInventory(ctx, db, dir, job)
+
+		if err != nil {
+			return "", err
 		}
 
-		// 2) Best-effort: capture terraform outputs
-		outputsJSON, err := captureTerraformOutputs(ctx, job)
+		// 3) Best-effort: capture terraform outputs onto the deployment and
+		// the run
+		captureOutputs(ctx, db, dir, job)
+
+		return summary, nil
+
+	case jobs.ActionDestroy:
+		// 1) Run destroy
+		summary, err := runTerraformDestroy(ctx, dir, job)
+
+		// 2) Best-effort: drop the destroyed resources from the inventory
+		syncInventory(ctx, db, dir, job)
+
 		if err != nil {
-			log.Printf("run %d: terraform apply succeeded but failed to capture outputs: %v", job.RunID, err)
-			// Do not fail the run just because outputs capture failed
-			return nil
+			return "", err
 		}
 
-		// 3) Persist outputs into deployments.outputs_json via the run → deployment relation
-		if err := persistOutputsForRun(ctx, db, job.RunID, outputsJSON); err != nil {
-			log.Printf("run %d: failed to persist outputs: %v", job.RunID, err)
+		// 3) Nothing is left to output; clear the deployment's outputs
+		if err := clearOutputsForRun(ctx, db, job.RunID); err != nil {
+			slog.ErrorContext(ctx, "failed to clear outputs", logging.Err(err))
 		}
 
-		return nil
+		return summary, nil
+
+	case jobs.ActionDrift:
+		summary, drifted, report, err := runTerraformDrift(ctx, dir, job)
+		if err != nil {
+			return "", err
+		}
+		if err := persistDriftForRun(ctx, db, job.RunID, drifted, report); err != nil {
+			return "", err
+		}
+		return summary, nil
 
 	default:
-		log.Printf("unsupported action %q, skipping", job.Action)
-		return nil
+		slog.WarnContext(ctx, "unsupported action, skipping", "action", job.Action)
+		return "", nil
 	}
-	return nil
 }
 
-func runTerraformPlan(ctx context.Context, job *Job) error {
-	modulePath, err := modulePathFor(job.BlueprintKey)
+func runTerraformPlan(ctx context.Context, modulePath string, job *jobs.Job) (string, error) {
+	// Credentials for this job, from the connection's provider (job.AWS)
+	creds, err := credentialsForJob(ctx, job)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("resolve credentials failed: %w", err)
 	}
 
-	// Assume role for this job (using values from job.AWS)
-	creds, err := assumeRoleForJob(ctx, job)
-	if err != nil {
-		return fmt.Errorf("assume role failed: %w", err)
-	}
+	env := creds.Env()
 
-	env := []string{
-		"AWS_ACCESS_KEY_ID=" + creds.AccessKeyID,
-		"AWS_SECRET_ACCESS_KEY=" + creds.SecretAccessKey,
-		"AWS_SESSION_TOKEN=" + creds.SessionToken,
-		"AWS_REGION=" + creds.Region,
-	}
-
-	log.Printf("run %d: running terraform plan in %s as assumed role in region %s", job.RunID, modulePath, creds.Region)
+	slog.InfoContext(ctx, "running terraform plan", "module", modulePath, "credential_provider", providerName(job), "region", creds.Region)
 
 	// Context with timeout for terraform commands
-	tctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	tctx, cancel := context.WithTimeout(ctx, jobTimeout(job))
 	defer cancel()
 
 	// 1) terraform init
 	if err := runTerraformCmd(tctx, modulePath, env, "init", "-input=false", "-no-color"); err != nil {
-		return fmt.Errorf("terraform init failed: %w", err)
+		return "", fmt.Errorf("terraform init failed: %w", err)
 	}
 
 	// Build -var arguments from job.Inputs
@@ -180,41 +267,32 @@ func runTerraformPlan(ctx context.Context, job *Job) error {
 
 	// 2) terraform plan
 	args := append([]string{"plan", "-input=false", "-no-color"}, varArgs...)
-	if err := runTerraformCmd(tctx, modulePath, env, args...); err != nil {
-		return fmt.Errorf("terraform plan failed: %w", err)
+	summary, err := runTerraformCmdWithSummary(tctx, modulePath, env, args...)
+	if err != nil {
+		return "", fmt.Errorf("terraform plan failed: %w", err)
 	}
 
-	return nil
+	return summary, nil
 }
 
-func runTerraformApply(ctx context.Context, job *Job) error {
-	modulePath, err := modulePathFor(job.BlueprintKey)
+func runTerraformApply(ctx context.Context, modulePath string, job *jobs.Job) (string, error) {
+	// Credentials for this job, from the connection's provider (job.AWS)
+	creds, err := credentialsForJob(ctx, job)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("resolve credentials failed: %w", err)
 	}
 
-	// Assume role for this job (using values from job.AWS)
-	creds, err := assumeRoleForJob(ctx, job)
-	if err != nil {
-		return fmt.Errorf("assume role failed: %w", err)
-	}
-
-	env := []string{
-		"AWS_ACCESS_KEY_ID=" + creds.AccessKeyID,
-		"AWS_SECRET_ACCESS_KEY=" + creds.SecretAccessKey,
-		"AWS_SESSION_TOKEN=" + creds.SessionToken,
-		"AWS_REGION=" + creds.Region,
-	}
+	env := creds.Env()
 
-	log.Printf("run %d: running terraform apply in %s as assumed role in region %s", job.RunID, modulePath, creds.Region)
+	slog.InfoContext(ctx, "running terraform apply", "module", modulePath, "credential_provider", providerName(job), "region", creds.Region)
 
 	// Context with timeout for terraform commands
-	tctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	tctx, cancel := context.WithTimeout(ctx, jobTimeout(job))
 	defer cancel()
 
 	// 1) terraform init
 	if err := runTerraformCmd(tctx, modulePath, env, "init", "-input=false", "-no-color"); err != nil {
-		return fmt.Errorf("terraform init failed: %w", err)
+		return "", fmt.Errorf("terraform init failed: %w", err)
 	}
 
 	// Build -var arguments from job.Inputs
@@ -225,41 +303,32 @@ func runTerraformApply(ctx context.Context, job *Job) error {
 
 	// 2) terraform apply -auto-approve
 	args := append([]string{"apply", "-input=false", "-auto-approve", "-no-color"}, varArgs...)
-	if err := runTerraformCmd(tctx, modulePath, env, args...); err != nil {
-		return fmt.Errorf("terraform apply failed: %w", err)
+	summary, err := runTerraformCmdWithSummary(tctx, modulePath, env, args...)
+	if err != nil {
+		return "", fmt.Errorf("terraform apply failed: %w", err)
 	}
 
-	return nil
+	return summary, nil
 }
 
-func runTerraformDestroy(ctx context.Context, job *Job) error {
-	modulePath, err := modulePathFor(job.BlueprintKey)
+func runTerraformDestroy(ctx context.Context, modulePath string, job *jobs.Job) (string, error) {
+	// Credentials for this job, from the connection's provider (job.AWS)
+	creds, err := credentialsForJob(ctx, job)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("resolve credentials failed: %w", err)
 	}
 
-	// Assume role for this job (using values from job.AWS)
-	creds, err := assumeRoleForJob(ctx, job)
-	if err != nil {
-		return fmt.Errorf("assume role failed: %w", err)
-	}
+	env := creds.Env()
 
-	env := []string{
-		"AWS_ACCESS_KEY_ID=" + creds.AccessKeyID,
-		"AWS_SECRET_ACCESS_KEY=" + creds.SecretAccessKey,
-		"AWS_SESSION_TOKEN=" + creds.SessionToken,
-		"AWS_REGION=" + creds.Region,
-	}
-
-	log.Printf("run %d: running terraform destroy in %s as assumed role in region %s", job.RunID, modulePath, creds.Region)
+	slog.InfoContext(ctx, "running terraform destroy", "module", modulePath, "credential_provider", providerName(job), "region", creds.Region)
 
 	// Context with timeout for terraform commands
-	tctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	tctx, cancel := context.WithTimeout(ctx, jobTimeout(job))
 	defer cancel()
 
 	// 1) terraform init
 	if err := runTerraformCmd(tctx, modulePath, env, "init", "-input=false", "-no-color"); err != nil {
-		return fmt.Errorf("terraform init failed: %w", err)
+		return "", fmt.Errorf("terraform init failed: %w", err)
 	}
 
 	// Build -var arguments from job.Inputs (so state/vars line up, though destroy mainly cares about state)
@@ -270,94 +339,129 @@ func runTerraformDestroy(ctx context.Context, job *Job) error {
 
 	// 2) terraform destroy -auto-approve
 	args := append([]string{"destroy", "-input=false", "-auto-approve", "-no-color"}, varArgs...)
-	if err := runTerraformCmd(tctx, modulePath, env, args...); err != nil {
-		return fmt.Errorf("terraform destroy failed: %w", err)
+	summary, err := runTerraformCmdWithSummary(tctx, modulePath, env, args...)
+	if err != nil {
+		return "", fmt.Errorf("terraform destroy failed: %w", err)
 	}
 
-	return nil
+	return summary, nil
 }
 
-// captureTerraformOutputs runs `terraform output -json` in the module
+// captureTerraformOutputs runs `terraform output -json` in the run's working
 // directory using the same assumed role and returns the raw JSON bytes.
-func captureTerraformOutputs(ctx context.Context, job *Job) ([]byte, error) {
-	modulePath, err := modulePathFor(job.BlueprintKey)
-	if err != nil {
-		return nil, err
-	}
-
-	creds, err := assumeRoleForJob(ctx, job)
+func captureTerraformOutputs(ctx context.Context, modulePath string, job *jobs.Job) ([]byte, error) {
+	creds, err := credentialsForJob(ctx, job)
 	if err != nil {
-		return nil, fmt.Errorf("assume role for outputs failed: %w", err)
+		return nil, fmt.Errorf("resolve credentials for outputs failed: %w", err)
 	}
 
-	env := []string{
-		"AWS_ACCESS_KEY_ID=" + creds.AccessKeyID,
-		"AWS_SECRET_ACCESS_KEY=" + creds.SecretAccessKey,
-		"AWS_SESSION_TOKEN=" + creds.SessionToken,
-		"AWS_REGION=" + creds.Region,
-	}
+	env := creds.Env()
 
 	tctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
 
-	args := []string{"-chdir=" + modulePath, "output", "-json"}
-	cmd := exec.CommandContext(tctx, "terraform", args...)
-	cmd.Env = append(os.Environ(), env...)
-
-	log.Printf("exec: terraform %v", args)
-
+	cmd := terraformCommand(tctx, modulePath, env, "output", "-json")
 	out, err := cmd.Output()
 	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = terraformFailure(tctx, err, string(exitErr.Stderr))
+		}
 		return nil, fmt.Errorf("terraform output -json failed: %w", err)
 	}
 
 	return out, nil
 }
 
-// persistOutputsForRun finds the deployment for the given run and updates
-// deployments.outputs_json with the given JSON blob.
+// captureOutputs records the outputs after an apply. It is best-effort: the
+// run doesn't fail just because outputs couldn't be captured.
+func captureOutputs(ctx context.Context, db *sql.DB, modulePath string, job *jobs.Job) {
+	outputsJSON, err := captureTerraformOutputs(ctx, modulePath, job)
+	if err != nil {
+		slog.ErrorContext(ctx, "terraform apply succeeded but failed to capture outputs", logging.Err(err))
+		return
+	}
+	if err := persistOutputsForRun(ctx, db, job.RunID, outputsJSON); err != nil {
+		slog.ErrorContext(ctx, "failed to persist outputs", logging.Err(err))
+	}
+}
+
+// persistOutputsForRun snapshots the outputs on the run (runs.outputs_json)
+// and makes them its deployment's current outputs.
 func persistOutputsForRun(ctx context.Context, db *sql.DB, runID int64, outputsJSON []byte) error {
 	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	var deploymentID int64
-	if err := db.QueryRowContext(ctx2,
-		"SELECT deployment_id FROM runs WHERE id = ?",
-		runID,
-	).Scan(&deploymentID); err != nil {
-		return fmt.Errorf("lookup deployment_id for run %d: %w", runID, err)
+	_, err := db.ExecContext(ctx2, `
+		UPDATE deployments dep
+		JOIN runs r ON r.deployment_id = dep.id
+		SET r.outputs_json = ?,
+		    dep.outputs_json = ?,
+		    dep.outputs_run_id = r.id
+		WHERE r.id = ?
+	`, string(outputsJSON), string(outputsJSON), runID)
+	if err != nil {
+		return fmt.Errorf("update outputs for run %d: %w", runID, err)
 	}
+	return nil
+}
 
-	_, err := db.ExecContext(ctx2,
-		"UPDATE deployments SET outputs_json = ? WHERE id = ?",
-		string(outputsJSON),
-		deploymentID,
-	)
+// clearOutputsForRun clears the outputs of a destroyed deployment, leaving
+// the destroy run an empty snapshot.
+func clearOutputsForRun(ctx context.Context, db *sql.DB, runID int64) error {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx2, `
+		UPDATE deployments dep
+		JOIN runs r ON r.deployment_id = dep.id
+		SET r.outputs_json = '{}',
+		    dep.outputs_json = NULL,
+		    dep.outputs_run_id = NULL
+		WHERE r.id = ?
+	`, runID)
 	if err != nil {
-		return fmt.Errorf("update deployments.outputs_json for deployment %d: %w", deploymentID, err)
+		return fmt.Errorf("clear outputs for run %d: %w", runID, err)
 	}
-
 	return nil
 }
 
 func runTerraformCmd(ctx context.Context, modulePath string, extraEnv []string, args ...string) error {
-	// We use -chdir so we don't have to change the worker's working directory
-	allArgs := append([]string{"-chdir=" + modulePath}, args...)
-	cmd := exec.CommandContext(ctx, "terraform", allArgs...)
+	cmd := terraformCommand(ctx, modulePath, extraEnv, args...)
 
-	// Process environment: inherit + override AWS credentials
-	cmd.Env = append(os.Environ(), extraEnv...)
+	// Output is logged line by line; keep stderr to classify failures
+	var stderr bytes.Buffer
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
 
-	// Stream terraform stdout/stderr into worker logs
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return terraformFailure(ctx, err, stderr.String())
+	}
+	return nil
+}
 
-	log.Printf("exec: terraform %v", allArgs)
+// summaryLineRE matches the one-line result terraform prints at the end of
+// plan/apply/destroy.
+var summaryLineRE = regexp.MustCompile(`(?m)^(Plan: .*|No changes\..*|Apply complete!.*|Destroy complete!.*)$`)
+
+// runTerraformCmdWithSummary behaves like runTerraformCmd but also returns
+// the last plan/apply/destroy summary line terraform printed (or "").
+func runTerraformCmdWithSummary(ctx context.Context, modulePath string, extraEnv []string, args ...string) (string, error) {
+	cmd := terraformCommand(ctx, modulePath, extraEnv, args...)
+
+	// Still logged, but keep a copy to extract the summary
+	var out, stderr bytes.Buffer
+	cmd.Stdout = io.MultiWriter(cmd.Stdout, &out)
+	cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
 
 	if err := cmd.Run(); err != nil {
-		return err
+		return "", terraformFailure(ctx, err, stderr.String())
 	}
-	return nil
+
+	matches := summaryLineRE.FindAllString(out.String(), -1)
+	if len(matches) == 0 {
+		return "", nil
+	}
+	return strings.TrimSpace(matches[len(matches)-1]), nil
 }
 
 func modulePathFor(blueprintKey string) (string, error) {
@@ -380,53 +484,36 @@ func getEnv(k, def string) string {
 	return def
 }
 
-// ---- AssumeRole helpers ---------------------------------------------------
-
-func assumeRoleForJob(ctx context.Context, job *Job) (*AWSCredentials, error) {
-	roleArn := job.AWS["roleArn"]
-	externalID := job.AWS["externalId"]
-	region := job.AWS["region"]
-	if region == "" {
-		region = "ap-northeast-1"
-	}
-
-	if roleArn == "" || externalID == "" {
-		return nil, fmt.Errorf("missing roleArn or externalId in job.AWS")
+func getEnvDuration(k string, def time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
 	}
-
-	// Load platform credentials (from AWS_PROFILE / env)
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	d, err := time.ParseDuration(v)
 	if err != nil {
-		return nil, fmt.Errorf("load default AWS config: %w", err)
+		fatal("invalid "+k, err)
 	}
+	return d
+}
 
-	stsClient := sts.NewFromConfig(cfg)
+// rejectJob parks a payload the worker can't safely run on jobs.RejectedQueue
+// and, when the run is identifiable, fails it so it doesn't sit queued forever.
+func rejectJob(ctx context.Context, rdb *redis.Client, db *sql.DB, payload string, reason error) {
+	slog.WarnContext(ctx, "rejecting job", logging.Err(reason))
+	jobsRejected.Inc()
 
-	dur := int32(3600)
-	out, err := stsClient.AssumeRole(ctx, &sts.AssumeRoleInput{
-		RoleArn:         &roleArn,
-		RoleSessionName: awsString(fmt.Sprintf("aip-run-%d", job.RunID)),
-		ExternalId:      &externalID,
-		DurationSeconds: &dur,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("STS AssumeRole error: %w", err)
+	if err := rdb.RPush(ctx, jobs.RejectedQueue, payload).Err(); err != nil {
+		slog.ErrorContext(ctx, "failed to park rejected job", logging.Err(err))
 	}
 
-	if out.Credentials == nil {
-		return nil, fmt.Errorf("STS AssumeRole returned nil credentials")
+	var verr *jobs.VersionError
+	if errors.As(reason, &verr) && verr.RunID > 0 {
+		if err := markRunFailed(ctx, db, verr.RunID, "worker rejected job: "+reason.Error()); err != nil {
+			slog.ErrorContext(logging.WithRun(ctx, verr.RunID), "failed to mark run failed", logging.Err(err))
+		}
 	}
-
-	return &AWSCredentials{
-		AccessKeyID:     *out.Credentials.AccessKeyId,
-		SecretAccessKey: *out.Credentials.SecretAccessKey,
-		SessionToken:    *out.Credentials.SessionToken,
-		Region:          region,
-	}, nil
 }
 
-func awsString(s string) *string { return &s }
-
 // ---- run status helpers ---------------------------------------------------
 
 func markRunRunning(ctx context.Context, db *sql.DB, runID int64) error {
@@ -442,16 +529,45 @@ func markRunRunning(ctx context.Context, db *sql.DB, runID int64) error {
 	return err
 }
 
-func markRunSucceeded(ctx context.Context, db *sql.DB, runID int64) error {
+// markRunQueued puts a run back in the queue while a retry waits out its
+// backoff.
+func markRunQueued(ctx context.Context, db *sql.DB, runID int64) error {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx2, `
+        UPDATE runs
+        SET status = 'queued'
+        WHERE id = ? AND status = 'running'
+    `, runID)
+	return err
+}
+
+func markRunSucceeded(ctx context.Context, db *sql.DB, runID int64, summary string) error {
 	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	_, err := db.ExecContext(ctx2, `
         UPDATE runs
         SET status = 'succeeded',
+            summary = NULLIF(?, ''),
             finished_at = IFNULL(finished_at, NOW())
         WHERE id = ?
-    `, runID)
+    `, summary, runID)
+	return err
+}
+
+func markRunTimedOut(ctx context.Context, db *sql.DB, runID int64, summary string) error {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx2, `
+        UPDATE runs
+        SET status = 'timed_out',
+            summary = ?,
+            finished_at = NOW()
+        WHERE id = ?
+    `, summary, runID)
 	return err
 }
 
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/your-org/aws-infra-platform/packages/platform/awsutil"
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+var (
+	runsStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aip_worker_runs_started_total",
+		Help: "Jobs taken off the queue, by action and blueprint.",
+	}, []string{"action", "blueprint"})
+
+	runsFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aip_worker_runs_finished_total",
+		Help: "Jobs finished, by action, blueprint and the status the run was left in.",
+	}, []string{"action", "blueprint", "status"})
+
+	jobsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "aip_worker_jobs_rejected_total",
+		Help: "Payloads moved to the rejected queue (bad JSON or unsupported contract version).",
+	})
+
+	queueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "aip_worker_job_queue_wait_seconds",
+		Help:    "How long jobs waited on the queue before a worker took them.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 14), // 100ms .. ~27m
+	})
+
+	terraformDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aip_worker_terraform_duration_seconds",
+		Help:    "Time taken by terraform commands, by subcommand (init, plan, apply, ...).",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 13), // 1s .. ~68m
+	}, []string{"command"})
+
+	stsDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "aip_worker_sts_request_duration_seconds",
+		Help:    "Latency of STS calls (AssumeRole etc.) including SDK retries.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	stsErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "aip_worker_sts_errors_total",
+		Help: "STS calls that failed after the SDK's retries.",
+	}, []string{"operation"})
+)
+
+// serveMetrics exports db's pool stats, starts recording STS calls and serves
+// /metrics on addr in the background.
+func serveMetrics(addr string, db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, "aip"))
+
+	awsutil.STSObserver = func(operation string, took time.Duration, err error) {
+		stsDuration.WithLabelValues(operation).Observe(took.Seconds())
+		if err != nil {
+			stsErrors.WithLabelValues(operation).Inc()
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		slog.Info("metrics listening", "addr", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("metrics server stopped", logging.Err(err))
+		}
+	}()
+}
+
+// observeRunStarted records a job taken off the queue.
+func observeRunStarted(job *jobs.Job) {
+	runsStarted.WithLabelValues(job.Action, job.BlueprintKey).Inc()
+	if !job.EnqueuedAt.IsZero() {
+		queueWait.Observe(time.Since(job.EnqueuedAt).Seconds())
+	}
+}
+
+// observeRunFinished records the status a job left its run in.
+func observeRunFinished(job *jobs.Job, status string) {
+	runsFinished.WithLabelValues(job.Action, job.BlueprintKey, status).Inc()
+}
+
+// observeTerraform records a terraform command started at start.
+func observeTerraform(subcommand string, start time.Time) {
+	terraformDuration.WithLabelValues(subcommand).Observe(time.Since(start).Seconds())
+}
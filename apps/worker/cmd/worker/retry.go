@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	redis "github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// defaultMaxAttempts is how many times each action is tried when its
+// failures look transient. An apply is retried less eagerly: a failure half
+// way through leaves work for the next attempt's plan to pick up.
+var defaultMaxAttempts = map[string]int{
+	jobs.ActionPlan:    3,
+	jobs.ActionApply:   2,
+	jobs.ActionDestroy: 3,
+	jobs.ActionDrift:   3,
+}
+
+// retryPolicy decides how often and how soon failed jobs are tried again.
+type retryPolicy struct {
+	MaxAttempts map[string]int
+	BaseDelay   time.Duration // before the second attempt; doubles after each
+	MaxDelay    time.Duration
+}
+
+// loadRetryPolicy reads RUN_MAX_ATTEMPTS ("apply=3,plan=4"; unlisted actions
+// keep their defaults), RETRY_BASE_DELAY and RETRY_MAX_DELAY.
+func loadRetryPolicy() (retryPolicy, error) {
+	p := retryPolicy{
+		MaxAttempts: map[string]int{},
+		BaseDelay:   getEnvDuration("RETRY_BASE_DELAY", 15*time.Second),
+		MaxDelay:    getEnvDuration("RETRY_MAX_DELAY", 5*time.Minute),
+	}
+	for action, n := range defaultMaxAttempts {
+		p.MaxAttempts[action] = n
+	}
+
+	if v := getEnv("RUN_MAX_ATTEMPTS", ""); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			action, n, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			attempts, err := strconv.Atoi(n)
+			if !ok || err != nil || attempts < 1 {
+				return p, fmt.Errorf("RUN_MAX_ATTEMPTS: invalid entry %q", pair)
+			}
+			if _, known := defaultMaxAttempts[action]; !known {
+				return p, fmt.Errorf("RUN_MAX_ATTEMPTS: unknown action %q", action)
+			}
+			p.MaxAttempts[action] = attempts
+		}
+	}
+	return p, nil
+}
+
+func (p retryPolicy) maxAttempts(action string) int {
+	if n, ok := p.MaxAttempts[action]; ok {
+		return n
+	}
+	return 1
+}
+
+// backoff is the delay after the given failed attempt: BaseDelay doubled per
+// attempt, capped at MaxDelay, with up to 20% jitter so runs that failed
+// together don't retry together.
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	return d - time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+// terraformError is a failed terraform command with the error output it
+// printed, kept for classifying the failure.
+type terraformError struct {
+	Err      error
+	Stderr   string
+	TimedOut bool // interrupted on reaching the job's timeout
+}
+
+func (e *terraformError) Error() string {
+	if e.TimedOut {
+		return "timed out: " + e.Err.Error()
+	}
+	// Terraform's first "Error: ..." line says more than its exit status.
+	for _, line := range strings.Split(e.Stderr, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "Error: ") {
+			return e.Err.Error() + ": " + line
+		}
+	}
+	return e.Err.Error()
+}
+
+func (e *terraformError) Unwrap() error { return e.Err }
+
+// Is makes a timed-out command match errTimedOut.
+func (e *terraformError) Is(target error) bool {
+	return e.TimedOut && target == errTimedOut
+}
+
+// transientOutputRE matches terraform output of failures worth retrying:
+// state lock contention, API throttling and network trouble.
+var transientOutputRE = regexp.MustCompile(`(?i)(` + strings.Join([]string{
+	`Error acquiring the state lock`,
+	`Throttling`,
+	`Rate exceeded`,
+	`RequestLimitExceeded`,
+	`TooManyRequests`,
+	`SlowDown`,
+	`ServiceUnavailable`,
+	`InternalFailure`,
+	`connection reset by peer`,
+	`connection refused`,
+	`i/o timeout`,
+	`TLS handshake timeout`,
+	`no such host`,
+	`unexpected EOF`,
+	`Client\.Timeout exceeded`,
+	`Failed to query available provider packages`,
+}, "|") + `)`)
+
+// retryable reports whether a failed job might succeed if simply run again.
+func retryable(err error) bool {
+	if errors.Is(err, errTimedOut) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var tfErr *terraformError
+	if errors.As(err, &tfErr) {
+		return transientOutputRE.MatchString(tfErr.Stderr)
+	}
+
+	// STS and other AWS SDK calls, after the SDK's own retries gave up
+	if retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err) == aws.TrueTernary {
+		return true
+	}
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// errRetryScheduled is returned for a job that failed transiently and has
+// been put on jobs.DelayedQueue to be tried again; its run is queued again
+// in the meantime.
+var errRetryScheduled = errors.New("retry scheduled")
+
+// runAttempt runs one attempt at the job, recorded in run_attempts. After a
+// transient failure below the action's attempt limit the next attempt is
+// scheduled on jobs.DelayedQueue, rather than waited for here, so the worker
+// is free for other jobs during the backoff.
+func runAttempt(ctx context.Context, rdb *redis.Client, db *sql.DB, policy retryPolicy, job *jobs.Job) (string, error) {
+	limit := policy.maxAttempts(job.Action)
+	attempt := max(job.Attempt, 1)
+
+	started := time.Now()
+	actx := logging.With(ctx, slog.Int("attempt", attempt))
+	attemptID, err := startAttempt(ctx, db, job, attempt)
+	if err != nil {
+		slog.ErrorContext(actx, "record attempt", logging.Err(err))
+	}
+
+	actx, span := tracer.Start(actx, "attempt", trace.WithAttributes(attribute.Int("aip.attempt", attempt)))
+	summary, err := handleJob(actx, rdb, db, job)
+	endSpan(span, err)
+
+	failed := err != nil && !errors.Is(err, errAwaitingApproval)
+	if errors.Is(err, errTimedOut) {
+		releaseStateLock(ctx, db, job, started)
+	}
+
+	transient := failed && retryable(err)
+	retry := transient && attempt < limit
+	delay := policy.backoff(attempt)
+	if retry {
+		if err2 := scheduleRetry(ctx, rdb, job, attempt+1, delay); err2 != nil {
+			slog.ErrorContext(actx, "schedule retry", logging.Err(err2))
+			// The run fails after all, so don't record the attempt as one
+			// that will be retried.
+			retry, transient = false, false
+		}
+	}
+	if attemptID > 0 {
+		if err2 := finishAttempt(ctx, db, attemptID, err, transient); err2 != nil {
+			slog.ErrorContext(actx, "record attempt result", logging.Err(err2))
+		}
+	}
+	if !retry {
+		return summary, err
+	}
+
+	slog.WarnContext(actx, "attempt failed with a transient error; retry scheduled",
+		"max_attempts", limit, "retry_in", delay.String(), logging.Err(err))
+	return "", fmt.Errorf("%w: %w", errRetryScheduled, err)
+}
+
+// scheduleRetry puts the job on jobs.DelayedQueue as the given attempt, due
+// after delay.
+func scheduleRetry(ctx context.Context, rdb *redis.Client, job *jobs.Job, attempt int, delay time.Duration) error {
+	due := time.Now().Add(delay)
+	retry := *job
+	retry.Attempt = attempt
+	retry.EnqueuedAt = due // the time on the queue starts when it's due
+	payload, err := jobs.Encode(retry)
+	if err != nil {
+		return err
+	}
+	return rdb.ZAdd(ctx, jobs.DelayedQueue, redis.Z{Score: float64(due.Unix()), Member: payload}).Err()
+}
+
+// promoteScript moves up to ARGV[2] payloads due by ARGV[1] from the delayed
+// set (KEYS[1]) to the queue (KEYS[2]) in one step, so two workers can't
+// both push one and a crash can't lose one.
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, payload in ipairs(due) do
+	redis.call('ZREM', KEYS[1], payload)
+	redis.call('RPUSH', KEYS[2], payload)
+end
+return #due
+`)
+
+// promoteDueRetries pushes retries whose backoff has passed onto jobs.Queue.
+func promoteDueRetries(ctx context.Context, rdb *redis.Client) {
+	n, err := promoteScript.Run(ctx, rdb, []string{jobs.DelayedQueue, jobs.Queue}, time.Now().Unix(), 100).Int()
+	if err != nil {
+		slog.ErrorContext(ctx, "promote due retries", logging.Err(err))
+		return
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "retries due; queued", "jobs", n)
+	}
+}
+
+// startAttempt records the start of an attempt at a run (or at a step of a
+// gated apply; each step counts its attempts separately).
+func startAttempt(ctx context.Context, db *sql.DB, job *jobs.Job, attempt int) (int64, error) {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := db.ExecContext(ctx2, `
+		INSERT INTO run_attempts (run_id, step, attempt, started_at)
+		VALUES (?, ?, ?, NOW())
+	`, job.RunID, job.Step, attempt)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// finishAttempt records an attempt's outcome; err is nil when it succeeded.
+func finishAttempt(ctx context.Context, db *sql.DB, attemptID int64, err error, retryable bool) error {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var msg any
+	if err != nil && !errors.Is(err, errAwaitingApproval) {
+		msg = err.Error()
+	}
+	_, err = db.ExecContext(ctx2, `
+		UPDATE run_attempts
+		SET finished_at = NOW(), error = ?, retryable = ?
+		WHERE id = ?
+	`, msg, retryable, attemptID)
+	return err
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"testing"
+	"time"
+
+	redis "github.com/redis/go-redis/v9"
+)
+
+// apiError is an AWS SDK-style error carrying an API error code.
+type apiError struct{ code string }
+
+func (e apiError) Error() string        { return "api error " + e.code }
+func (e apiError) ErrorCode() string    { return e.code }
+func (e apiError) ErrorMessage() string { return "" }
+
+func TestRetryable(t *testing.T) {
+	exitErr := &exec.ExitError{}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"state lock contention", &terraformError{Err: exitErr, Stderr: "Error: Error acquiring the state lock\n\nLock Info:"}, true},
+		{"throttled", &terraformError{Err: exitErr, Stderr: "api error Throttling: Rate exceeded"}, true},
+		{"matches case-insensitively", &terraformError{Err: exitErr, Stderr: "error: requestlimitexceeded"}, true},
+		{"network trouble", &terraformError{Err: exitErr, Stderr: "dial tcp: lookup sts.amazonaws.com: no such host"}, true},
+		{"provider registry unreachable", &terraformError{Err: exitErr, Stderr: "Error: Failed to query available provider packages"}, true},
+		{"wrapped terraform error", fmt.Errorf("apply: %w", &terraformError{Err: exitErr, Stderr: "read: connection reset by peer"}), true},
+		{"configuration error", &terraformError{Err: exitErr, Stderr: `Error: Unsupported argument "foo"`}, false},
+		{"access denied", &terraformError{Err: exitErr, Stderr: "AccessDenied: not authorized to perform: ecs:CreateService"}, false},
+		{"timed out, even with transient output", &terraformError{Err: exitErr, Stderr: "i/o timeout", TimedOut: true}, false},
+		{"cancelled", fmt.Errorf("assume role: %w", context.Canceled), false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"AWS throttling code", fmt.Errorf("assume role: %w", apiError{"ThrottlingException"}), true},
+		{"AWS retryable code", apiError{"RequestTimeout"}, true},
+		{"AWS non-retryable code", apiError{"AccessDenied"}, false},
+		{"plain error", errors.New("blueprint not found"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransientOutputRE(t *testing.T) {
+	tests := []struct {
+		output string
+		want   bool
+	}{
+		{"Error: Error acquiring the state lock", true},
+		{"ThrottlingException: Rate exceeded", true},
+		{"TooManyRequestsException", true},
+		{"SlowDown: Please reduce your request rate", true},
+		{"ServiceUnavailable", true},
+		{"InternalFailure", true},
+		{"dial tcp 10.0.0.1:443: connect: connection refused", true},
+		{"net/http: TLS handshake timeout", true},
+		{"unexpected EOF", true},
+		{"(Client.Timeout exceeded while awaiting headers)", true},
+		{"Client Timeout exceeded", false}, // the dot is literal
+		{"Error: Invalid value for variable", false},
+		{"ResourceInUseException: service already exists", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := transientOutputRE.MatchString(tt.output); got != tt.want {
+			t.Errorf("match %q = %v, want %v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := retryPolicy{BaseDelay: 10 * time.Second, MaxDelay: time.Minute}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration // before jitter
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute}, // capped
+		{20, time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.attempt), func(t *testing.T) {
+			lo := tt.max - tt.max/5
+			for range 1000 {
+				if d := p.backoff(tt.attempt); d < lo || d > tt.max {
+					t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, d, lo, tt.max)
+				}
+			}
+		})
+	}
+}
+
+// TestPromoteScript needs a Redis server at REDIS_ADDR (default
+// 127.0.0.1:6379) and is skipped without one.
+func TestPromoteScript(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{Addr: getEnv("REDIS_ADDR", "127.0.0.1:6379")})
+	defer rdb.Close()
+	ctx := context.Background()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Skipf("no Redis: %v", err)
+	}
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	delayed, queue := "test:delayed:"+suffix, "test:queue:"+suffix
+	defer rdb.Del(ctx, delayed, queue)
+
+	now := time.Now().Unix()
+	rdb.ZAdd(ctx, delayed,
+		redis.Z{Score: float64(now - 20), Member: "a"},
+		redis.Z{Score: float64(now - 10), Member: "b"},
+		redis.Z{Score: float64(now), Member: "c"},
+		redis.Z{Score: float64(now + 60), Member: "later"},
+	)
+
+	// At most ARGV[2] at a time, oldest first
+	n, err := promoteScript.Run(ctx, rdb, []string{delayed, queue}, now, 2).Int()
+	if err != nil || n != 2 {
+		t.Fatalf("promote = %d, %v; want 2", n, err)
+	}
+	n, err = promoteScript.Run(ctx, rdb, []string{delayed, queue}, now, 100).Int()
+	if err != nil || n != 1 {
+		t.Fatalf("promote = %d, %v; want 1", n, err)
+	}
+
+	queued, _ := rdb.LRange(ctx, queue, 0, -1).Result()
+	if fmt.Sprint(queued) != "[a b c]" {
+		t.Errorf("queue = %v, want [a b c]", queued)
+	}
+	left, _ := rdb.ZRange(ctx, delayed, 0, -1).Result()
+	if fmt.Sprint(left) != "[later]" {
+		t.Errorf("delayed = %v, want [later]", left)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/logging"
+)
+
+// defaultTimeouts bound jobs whose blueprint declares no timeout for the
+// action.
+var defaultTimeouts = map[string]time.Duration{
+	jobs.ActionPlan:    5 * time.Minute,
+	jobs.ActionApply:   10 * time.Minute,
+	jobs.ActionDestroy: 10 * time.Minute,
+	jobs.ActionDrift:   5 * time.Minute,
+}
+
+// interruptGrace is how long terraform gets to stop cleanly (and release its
+// state lock) after being interrupted, before it is killed.
+var interruptGrace = 2 * time.Minute
+
+// errTimedOut matches failures caused by a job running past its timeout.
+var errTimedOut = errors.New("timed out")
+
+// loadTimeouts reads RUN_TIMEOUTS ("apply=30m,plan=10m"; unlisted actions
+// keep their defaults) and TERRAFORM_INTERRUPT_GRACE.
+func loadTimeouts() error {
+	if v := getEnv("TERRAFORM_INTERRUPT_GRACE", ""); v != "" {
+		grace, err := time.ParseDuration(v)
+		if err != nil || grace < 0 {
+			return fmt.Errorf("TERRAFORM_INTERRUPT_GRACE: invalid duration %q", v)
+		}
+		interruptGrace = grace
+	}
+
+	v := getEnv("RUN_TIMEOUTS", "")
+	if v == "" {
+		return nil
+	}
+	for _, pair := range strings.Split(v, ",") {
+		action, d, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		timeout, err := time.ParseDuration(d)
+		if !ok || err != nil || timeout <= 0 {
+			return fmt.Errorf("RUN_TIMEOUTS: invalid entry %q", pair)
+		}
+		if _, known := defaultTimeouts[action]; !known {
+			return fmt.Errorf("RUN_TIMEOUTS: unknown action %q", action)
+		}
+		defaultTimeouts[action] = timeout
+	}
+	return nil
+}
+
+// jobTimeout is how long the job's terraform commands may take in total: the
+// blueprint's timeout carried by the job, else the worker's default.
+func jobTimeout(job *jobs.Job) time.Duration {
+	if job.TimeoutSeconds > 0 {
+		return time.Duration(job.TimeoutSeconds) * time.Second
+	}
+	action := job.Action
+	if job.Step == jobs.StepPlanForApproval {
+		action = jobs.ActionPlan
+	}
+	return defaultTimeouts[action]
+}
+
+// terraformCmd is a terraform command whose Run and Output record how long
+// it took, and trace it as a child of the job's span. Its Stdout and Stderr
+// start out logging each line; callers that need the output too tee them.
+type terraformCmd struct {
+	*exec.Cmd
+	ctx            context.Context
+	subcommand     string
+	stdout, stderr *logWriter
+}
+
+func (c *terraformCmd) Run() (err error) {
+	defer c.observe(time.Now())(&err)
+	defer c.stdout.Flush()
+	defer c.stderr.Flush()
+	return c.Cmd.Run()
+}
+
+// Output returns what terraform printed on stdout, without logging it
+// (show and output print state and outputs, which may hold secrets). Stderr
+// is kept on the *exec.ExitError.
+func (c *terraformCmd) Output() (out []byte, err error) {
+	defer c.observe(time.Now())(&err)
+	c.Cmd.Stdout, c.Cmd.Stderr = nil, nil
+	return c.Cmd.Output()
+}
+
+// observe starts the command's span; the returned function ends it with the
+// command's error and records the duration.
+func (c *terraformCmd) observe(start time.Time) func(*error) {
+	_, span := tracer.Start(c.ctx, "terraform "+c.subcommand,
+		trace.WithTimestamp(start),
+		trace.WithAttributes(attribute.String("aip.terraform.command", c.subcommand)))
+	return func(err *error) {
+		observeTerraform(c.subcommand, start)
+		endSpan(span, *err)
+	}
+}
+
+// terraformCommand builds `terraform -chdir=modulePath args...`. When ctx is
+// done terraform is interrupted rather than killed, so it can stop cleanly;
+// it is killed only if still running interruptGrace later.
+func terraformCommand(ctx context.Context, modulePath string, extraEnv []string, args ...string) *terraformCmd {
+	// We use -chdir so we don't have to change the worker's working directory
+	allArgs := append([]string{"-chdir=" + modulePath}, args...)
+	cmd := exec.CommandContext(ctx, "terraform", allArgs...)
+
+	// Process environment: inherit + override AWS credentials
+	cmd.Env = append(os.Environ(), extraEnv...)
+
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = interruptGrace
+
+	tc := &terraformCmd{Cmd: cmd, ctx: ctx, subcommand: args[0]}
+	attrs := []slog.Attr{slog.String("terraform", tc.subcommand)}
+	tc.stdout = &logWriter{ctx: ctx, level: slog.LevelInfo, attrs: append(attrs, slog.String("stream", "stdout"))}
+	tc.stderr = &logWriter{ctx: ctx, level: slog.LevelWarn, attrs: append(attrs, slog.String("stream", "stderr"))}
+	cmd.Stdout, cmd.Stderr = tc.stdout, tc.stderr
+
+	slog.InfoContext(ctx, "exec terraform", "args", allArgs)
+	return tc
+}
+
+// terraformFailure wraps the error of a terraform command run under ctx.
+func terraformFailure(ctx context.Context, err error, stderr string) *terraformError {
+	return &terraformError{
+		Err:      err,
+		Stderr:   stderr,
+		TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+	}
+}
+
+// lockInfoRE picks fields out of the lock info terraform prints when it
+// can't acquire the state lock.
+var lockInfoRE = regexp.MustCompile(`(?m)^\s*(ID|Who|Created):\s*(.*?)\s*$`)
+
+// releaseStateLock frees a state lock a timed-out job's terraform may have
+// left behind if it had to be killed. Terraform can't be asked who holds a
+// lock, so this probes with a plan that gives up on the lock at once; a lock
+// it reports as taken by this host since the job started is force-unlocked.
+func releaseStateLock(ctx context.Context, db *sql.DB, job *jobs.Job, since time.Time) {
+	modulePath, cleanup, err := newWorkdir(ctx, db, job)
+	if err != nil {
+		slog.ErrorContext(ctx, "check state lock: prepare working directory failed", logging.Err(err))
+		return
+	}
+	defer cleanup()
+
+	creds, err := credentialsForJob(ctx, job)
+	if err != nil {
+		slog.ErrorContext(ctx, "check state lock: resolve credentials failed", logging.Err(err))
+		return
+	}
+	env := creds.Env()
+
+	tctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	args := []string{"plan", "-input=false", "-no-color", "-refresh=false", "-lock-timeout=0"}
+	for k, v := range job.Inputs {
+		args = append(args, "-var", fmt.Sprintf("%s=%v", k, v))
+	}
+	cmd := terraformCommand(tctx, modulePath, env, args...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err == nil || !strings.Contains(out.String(), "Error acquiring the state lock") {
+		return // not locked
+	}
+
+	lock, err := parseLockInfo(out.String())
+	if err != nil {
+		slog.WarnContext(ctx, "state is locked but the lock info couldn't be read; leaving it", logging.Err(err))
+		return
+	}
+	if !lock.heldBy(lockOwner(), since) {
+		slog.InfoContext(ctx, "state is locked, not by this run; leaving it", "lock_who", lock.Who, "lock_created", lock.Created)
+		return
+	}
+
+	if err := runTerraformCmd(tctx, modulePath, env, "force-unlock", "-force", lock.ID); err != nil {
+		slog.ErrorContext(ctx, "release state lock", "lock_id", lock.ID, logging.Err(err))
+		return
+	}
+	slog.InfoContext(ctx, "released state lock left by the timed-out run", "lock_id", lock.ID)
+}
+
+// lockInfo is the lock terraform reports holding the state.
+type lockInfo struct {
+	ID      string
+	Who     string
+	Created time.Time
+}
+
+// parseLockInfo reads the lock info from terraform's "Error acquiring the
+// state lock" output.
+func parseLockInfo(output string) (lockInfo, error) {
+	fields := map[string]string{}
+	for _, m := range lockInfoRE.FindAllStringSubmatch(output, -1) {
+		fields[m[1]] = m[2]
+	}
+	if fields["ID"] == "" {
+		return lockInfo{}, errors.New("no lock ID")
+	}
+	created, err := time.Parse("2006-01-02 15:04:05.999999999 -0700 MST", fields["Created"])
+	if err != nil {
+		return lockInfo{}, fmt.Errorf("lock creation time: %w", err)
+	}
+	return lockInfo{ID: fields["ID"], Who: fields["Who"], Created: created}, nil
+}
+
+// heldBy reports whether the lock was taken by owner (see lockOwner) no
+// earlier than since, i.e. by the run that started then.
+func (l lockInfo) heldBy(owner string, since time.Time) bool {
+	return l.Who == owner && !l.Created.Before(since)
+}
+
+// lockOwner is the "Who" terraform records on locks it takes from this
+// process: user@hostname.
+func lockOwner() string {
+	name := ""
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return name + "@" + host
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+const lockedOutput = `
+Error: Error acquiring the state lock
+
+Error message: resource temporarily unavailable
+Lock Info:
+  ID:        6d6ea4a0-5b7b-3a1c-2f0e-6f1f7b9a2c3d
+  Path:      /var/lib/aip/state/17/terraform.tfstate
+  Operation: OperationTypeApply
+  Who:       aip@worker-1
+  Version:   1.9.5
+  Created:   2026-10-18 15:04:05.123456789 +0000 UTC
+  Info:
+
+Terraform acquires a state lock to protect the state from being written
+by multiple users at the same time.
+`
+
+func TestParseLockInfo(t *testing.T) {
+	lock, err := parseLockInfo(lockedOutput)
+	if err != nil {
+		t.Fatalf("parseLockInfo: %v", err)
+	}
+	want := lockInfo{
+		ID:      "6d6ea4a0-5b7b-3a1c-2f0e-6f1f7b9a2c3d",
+		Who:     "aip@worker-1",
+		Created: time.Date(2026, 10, 18, 15, 4, 5, 123456789, time.UTC),
+	}
+	if lock.ID != want.ID || lock.Who != want.Who || !lock.Created.Equal(want.Created) {
+		t.Errorf("lock = %+v, want %+v", lock, want)
+	}
+
+	for name, output := range map[string]string{
+		"no lock info":  "Error: Error acquiring the state lock\n",
+		"no ID":         "  Who:       aip@worker-1\n  Created:   2026-10-18 15:04:05.123456789 +0000 UTC\n",
+		"bad timestamp": "  ID:        6d6ea4a0\n  Created:   yesterday\n",
+	} {
+		if _, err := parseLockInfo(output); err == nil {
+			t.Errorf("%s: parseLockInfo succeeded, want an error", name)
+		}
+	}
+}
+
+func TestLockHeldBy(t *testing.T) {
+	started := time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC)
+	lock := lockInfo{ID: "1", Who: "aip@worker-1", Created: started.Add(time.Minute)}
+
+	tests := []struct {
+		name  string
+		owner string
+		since time.Time
+		want  bool
+	}{
+		{"taken by this host after the run started", "aip@worker-1", started, true},
+		{"taken the instant the run started", "aip@worker-1", lock.Created, true},
+		{"taken by another worker", "aip@worker-2", started, false},
+		{"taken by this host before the run started", "aip@worker-1", started.Add(2 * time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lock.heldBy(tt.owner, tt.since); got != tt.want {
+				t.Errorf("heldBy(%q, %s) = %v, want %v", tt.owner, tt.since, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTimeouts(t *testing.T) {
+	defaults := maps.Clone(defaultTimeouts)
+	grace := interruptGrace
+	reset := func() {
+		defaultTimeouts = maps.Clone(defaults)
+		interruptGrace = grace
+	}
+	t.Cleanup(reset)
+
+	tests := []struct {
+		name      string
+		timeouts  string
+		grace     string
+		wantErr   bool
+		wantPlan  time.Duration
+		wantApply time.Duration
+		wantGrace time.Duration
+	}{
+		{
+			name:      "unset keeps the defaults",
+			wantPlan:  defaults["plan"],
+			wantApply: defaults["apply"],
+			wantGrace: grace,
+		},
+		{
+			name:      "overrides listed actions only",
+			timeouts:  "apply=30m, plan=90s",
+			grace:     "45s",
+			wantPlan:  90 * time.Second,
+			wantApply: 30 * time.Minute,
+			wantGrace: 45 * time.Second,
+		},
+		{
+			name:      "zero grace kills at once",
+			grace:     "0s",
+			wantPlan:  defaults["plan"],
+			wantApply: defaults["apply"],
+			wantGrace: 0,
+		},
+		{name: "unknown action", timeouts: "launch=5m", wantErr: true},
+		{name: "missing duration", timeouts: "apply", wantErr: true},
+		{name: "invalid duration", timeouts: "apply=ten minutes", wantErr: true},
+		{name: "zero timeout", timeouts: "plan=0s", wantErr: true},
+		{name: "invalid grace", grace: "2 minutes", wantErr: true},
+		{name: "negative grace", grace: "-1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reset()
+			t.Setenv("RUN_TIMEOUTS", tt.timeouts)
+			t.Setenv("TERRAFORM_INTERRUPT_GRACE", tt.grace)
+
+			err := loadTimeouts()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("loadTimeouts succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadTimeouts: %v", err)
+			}
+			if defaultTimeouts["plan"] != tt.wantPlan || defaultTimeouts["apply"] != tt.wantApply {
+				t.Errorf("timeouts = plan %s, apply %s; want %s, %s", defaultTimeouts["plan"], defaultTimeouts["apply"], tt.wantPlan, tt.wantApply)
+			}
+			if interruptGrace != tt.wantGrace {
+				t.Errorf("interruptGrace = %s, want %s", interruptGrace, tt.wantGrace)
+			}
+		})
+	}
+}
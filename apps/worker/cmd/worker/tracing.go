@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+	"github.com/your-org/aws-infra-platform/packages/platform/tracing"
+)
+
+var tracer = tracing.Tracer("apps/worker")
+
+// jobAttributes identify the run a span belongs to.
+func jobAttributes(job *jobs.Job) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.Int64("aip.run_id", job.RunID),
+		attribute.String("aip.action", job.Action),
+		attribute.String("aip.step", job.Step),
+		attribute.String("aip.blueprint", job.BlueprintKey+"@"+job.Version),
+	}
+}
+
+// startJobSpan continues, under ctx, the trace the job was enqueued under.
+// The time the job spent on the queue is recorded as its own span, then a
+// span covering its processing is started; end it when the run is finished
+// with.
+func startJobSpan(ctx context.Context, job *jobs.Job) (context.Context, trace.Span) {
+	ctx = tracing.ExtractJob(ctx, job)
+
+	attrs := append(jobAttributes(job),
+		attribute.String("messaging.system", "redis"),
+		attribute.String("messaging.destination.name", jobs.Queue),
+	)
+	if !job.EnqueuedAt.IsZero() {
+		_, wait := tracer.Start(ctx, jobs.Queue+" receive",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithTimestamp(job.EnqueuedAt),
+			trace.WithAttributes(attrs...),
+		)
+		wait.End()
+	}
+	return tracer.Start(ctx, jobs.Queue+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endSpan ends span, recording err (if any) as its error. A gated apply
+// parked for approval is not an error, nor is a job whose failed attempt
+// (recorded on the attempt's span) will be retried.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, errAwaitingApproval) && !errors.Is(err, errRetryScheduled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+// stateRoot holds each deployment's terraform state, at
+// <stateRoot>/<deployment id>/terraform.tfstate. Every worker must see the
+// same directory (a shared volume when there are several hosts).
+var stateRoot = "../../.aip-state"
+
+// loadStateRoot reads TERRAFORM_STATE_DIR and creates it. Unless
+// TF_PLUGIN_CACHE_DIR is set, providers are cached under it too, so the
+// per-run working directories don't download them every time.
+func loadStateRoot() error {
+	root, err := filepath.Abs(getEnv("TERRAFORM_STATE_DIR", stateRoot))
+	if err != nil {
+		return err
+	}
+	stateRoot = root
+	if err := os.MkdirAll(stateRoot, 0o700); err != nil {
+		return err
+	}
+
+	if os.Getenv("TF_PLUGIN_CACHE_DIR") == "" {
+		cache := filepath.Join(stateRoot, "plugin-cache")
+		if err := os.MkdirAll(cache, 0o700); err != nil {
+			return err
+		}
+		return os.Setenv("TF_PLUGIN_CACHE_DIR", cache)
+	}
+	return nil
+}
+
+// backendOverride points a module's state at its deployment's file. As an
+// override file it takes the place of any backend the module declares.
+const backendOverride = `terraform {
+  backend "local" {
+    path = %q
+  }
+}
+`
+
+// newWorkdir copies the job's blueprint module into a directory of its own,
+// with its state pointed at the run's deployment, so runs of different
+// deployments (or concurrent runs) never share .terraform or state. Call
+// the returned function to remove it.
+func newWorkdir(ctx context.Context, db *sql.DB, job *jobs.Job) (string, func(), error) {
+	modulePath, err := modulePathFor(job.BlueprintKey)
+	if err != nil {
+		return "", nil, err
+	}
+	deploymentID, err := deploymentIDForRun(ctx, db, job.RunID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", fmt.Sprintf("aip-run-%d-", job.RunID))
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if err := copyModule(dir, modulePath); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("copy module %s: %w", job.BlueprintKey, err)
+	}
+
+	statePath := filepath.Join(stateRoot, strconv.FormatInt(deploymentID, 10), "terraform.tfstate")
+	if err := os.MkdirAll(filepath.Dir(statePath), 0o700); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	override := fmt.Sprintf(backendOverride, statePath)
+	if err := os.WriteFile(filepath.Join(dir, "aip_backend_override.tf"), []byte(override), 0o600); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// copyModule copies the module's configuration into dir, leaving out
+// anything a local terraform run may have left there (.terraform, state).
+func copyModule(dir, modulePath string) error {
+	return filepath.WalkDir(modulePath, func(path string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(modulePath, path)
+		if err != nil {
+			return err
+		}
+		name := e.Name()
+		if e.IsDir() {
+			if name == ".terraform" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(dir, rel), 0o700)
+		}
+		if !e.Type().IsRegular() || strings.HasPrefix(name, "terraform.tfstate") {
+			return nil
+		}
+		return copyFile(filepath.Join(dir, rel), path)
+	})
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// deploymentIDForRun looks up the deployment a run belongs to.
+func deploymentIDForRun(ctx context.Context, db *sql.DB, runID int64) (int64, error) {
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var deploymentID int64
+	if err := db.QueryRowContext(ctx2,
+		"SELECT deployment_id FROM runs WHERE id = ?",
+		runID,
+	).Scan(&deploymentID); err != nil {
+		return 0, fmt.Errorf("lookup deployment_id for run %d: %w", runID, err)
+	}
+	return deploymentID, nil
+}
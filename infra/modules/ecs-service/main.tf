@@ -1,3 +1,5 @@
+# No backend here: the worker gives each deployment its own state with an
+# aip_backend_override.tf in the run's working directory.
 terraform {
   required_providers {
     aws = {
@@ -100,3 +100,20 @@ resource "aws_iam_role_policy" "aip_allow_task_execution_role" {
     ]
   })
 }
+
+# Lets the platform simulate this role's policies before enqueueing a run.
+resource "aws_iam_role_policy" "aip_preflight" {
+  name = "aip-preflight"
+  role = aws_iam_role.aip_target_deploy.id
+
+  policy = jsonencode({
+    Version = "2012-10-17",
+    Statement = [
+      {
+        Effect   = "Allow",
+        Action   = ["iam:SimulatePrincipalPolicy"],
+        Resource = aws_iam_role.aip_target_deploy.arn
+      }
+    ]
+  })
+}
@@ -0,0 +1,124 @@
+// Package awsutil holds the AWS SDK helpers shared by the API (which verifies
+// connections) and the worker (which runs terraform with them), so both reach
+// a customer role the same way.
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/tracing"
+)
+
+// Credential providers a connection can use, as stored on
+// aws_connections.credential_provider and sent in jobs.AWSTarget.
+const (
+	ProviderAssumeRole  = "assume_role"  // platform credentials -> target role
+	ProviderHubChain    = "hub_chain"    // platform -> hub role -> target role
+	ProviderWebIdentity = "web_identity" // OIDC token -> target role
+	ProviderStatic      = "static"       // worker's AIP_STATIC_AWS_* keys; local testing only
+)
+
+// ValidProvider reports whether name is a known credential provider.
+func ValidProvider(name string) bool {
+	switch name {
+	case ProviderAssumeRole, ProviderHubChain, ProviderWebIdentity, ProviderStatic:
+		return true
+	}
+	return false
+}
+
+// stsHostRE matches the STS endpoints a connection may point at: global and
+// regional endpoints (including the China partition) and interface VPC
+// endpoints. Anything else could be handed the worker's OIDC token or return
+// credentials of its own.
+var stsHostRE = regexp.MustCompile(`^(sts(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?|vpce-[a-z0-9-]+\.sts\.[a-z0-9-]+\.vpce\.amazonaws\.com(\.cn)?)$`)
+
+// ValidSTSEndpoint checks that endpoint, a connection's STS override, is an
+// https URL for an AWS STS host. An empty endpoint (the default) is valid.
+func ValidSTSEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.Port() != "" || (u.Path != "" && u.Path != "/") {
+		return errors.New("stsEndpoint must be an https URL with no port or path")
+	}
+	if !stsHostRE.MatchString(u.Hostname()) {
+		return errors.New("stsEndpoint must be an AWS STS endpoint (sts[.<region>].amazonaws.com[.cn] or a vpce-*.sts.<region>.vpce.amazonaws.com endpoint)")
+	}
+	return nil
+}
+
+// STSObserver, if set, is told how each call made with a client from
+// NewSTSClient went (including the SDK's retries), so the API and worker can
+// record STS latency and errors.
+var STSObserver func(operation string, took time.Duration, err error)
+
+// NewSTSClient builds an STS client, pointed at endpoint when a connection
+// overrides the regional one (VPC endpoints, partitions). Check endpoint with
+// ValidSTSEndpoint first.
+func NewSTSClient(cfg aws.Config, endpoint string) *sts.Client {
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.APIOptions = append(o.APIOptions, instrumentSTS)
+	})
+}
+
+// instrumentSTS adds middleware tracing each call and reporting it to
+// STSObserver. It goes after the SDK's own initialize middleware, which
+// records the operation name.
+func instrumentSTS(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("AIPInstrumentSTS",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			operation := awsmiddleware.GetOperationName(ctx)
+			ctx, span := tracing.Tracer("awsutil").Start(ctx, "STS."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("rpc.system", "aws-api"),
+					attribute.String("rpc.service", "STS"),
+					attribute.String("rpc.method", operation),
+				))
+			defer span.End()
+
+			start := time.Now()
+			out, md, err := next.HandleInitialize(ctx, in)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "STS "+operation+" failed")
+			}
+			if STSObserver != nil {
+				STSObserver(operation, time.Since(start), err)
+			}
+			return out, md, err
+		}), middleware.After)
+}
+
+// ViaHubRole returns a copy of cfg whose credentials come from assuming
+// hubRoleArn with cfg's own credentials, for chaining into accounts that only
+// trust a hub account.
+func ViaHubRole(cfg aws.Config, stsEndpoint, hubRoleArn, hubExternalID, sessionName string) aws.Config {
+	hub := stscreds.NewAssumeRoleProvider(NewSTSClient(cfg, stsEndpoint), hubRoleArn, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if hubExternalID != "" {
+			o.ExternalID = aws.String(hubExternalID)
+		}
+	})
+	cfg = cfg.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(hub)
+	return cfg
+}
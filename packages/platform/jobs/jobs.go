@@ -0,0 +1,197 @@
+// Package jobs is the contract between the API, which enqueues runs, and the
+// worker, which executes them. Both sides must go through Encode and Decode so
+// a payload is never interpreted under a contract version it wasn't built for.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Queue is the Redis list jobs are RPUSHed onto and BLPOPed from.
+const Queue = "aip:jobs"
+
+// DelayedQueue is a Redis sorted set of payloads to push onto Queue later,
+// scored by the Unix time they are due. Workers schedule retries there
+// rather than waiting them out.
+const DelayedQueue = "aip:jobs:delayed"
+
+// RejectedQueue holds payloads a worker refused (bad JSON or an unsupported
+// contract version) so they can be inspected instead of silently dropped.
+const RejectedQueue = "aip:jobs:rejected"
+
+// Contract versions. Bump ContractVersion for any change a worker built
+// against the previous version would misread; raise MinContractVersion once
+// producers of the old version are gone.
+//
+// v2 added Step; a v1 worker would run a gated apply straight through.
+const (
+	ContractVersion    = 2
+	MinContractVersion = 1
+)
+
+// Actions a job can ask the worker to perform.
+const (
+	ActionPlan    = "plan"
+	ActionApply   = "apply"
+	ActionDestroy = "destroy"
+	ActionDrift   = "drift"
+)
+
+// Steps of an apply that needs approval. An apply job without a Step plans
+// and applies in one go.
+const (
+	// Plan, store the plan under PlanKey and park the run awaiting approval.
+	StepPlanForApproval = "plan_for_approval"
+	// Apply the plan stored under PlanKey.
+	StepApplyPlan = "apply_plan"
+)
+
+// MaxPlanAge bounds how long a stored plan is kept, and so how long a run
+// can wait for approval.
+const MaxPlanAge = 7 * 24 * time.Hour
+
+// PlanKey is the Redis key holding the saved plan of an apply run between its
+// plan and apply steps.
+func PlanKey(runID int64) string {
+	return fmt.Sprintf("aip:plans:%d", runID)
+}
+
+// Job is one run for the worker to execute.
+type Job struct {
+	ContractVersion int            `json:"contract_version"`
+	RunID           int64          `json:"run_id"`
+	Action          string         `json:"action"`
+	Step            string         `json:"step,omitempty"` // apply only; see Step*
+	BlueprintKey    string         `json:"blueprint_key"`
+	Version         string         `json:"version"`
+	Inputs          map[string]any `json:"inputs"`
+	AWS             AWSTarget      `json:"aws"`
+
+	// How long terraform may run before the worker interrupts it; 0 leaves
+	// it to the worker's default for the action.
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+
+	// When the producer pushed the job onto Queue, for measuring how long
+	// jobs wait. Zero in payloads from producers that predate it.
+	EnqueuedAt time.Time `json:"enqueued_at,omitzero"`
+
+	// W3C trace context (traceparent, tracestate) of the span that enqueued
+	// the job, so the worker's spans join the request's trace.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+
+	// ID of the API request that started the run, if any, so the worker's
+	// log lines can be matched to the request's.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Which attempt at the run (or step) this is, for retries scheduled on
+	// DelayedQueue; 0 means the first.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// AWSTarget says where a job runs and how the worker obtains credentials.
+// CredentialProvider is one of the awsutil.Provider* names; empty means
+// awsutil.ProviderAssumeRole.
+type AWSTarget struct {
+	RoleArn            string `json:"roleArn"`
+	ExternalID         string `json:"externalId,omitempty"`
+	Region             string `json:"region"`
+	CredentialProvider string `json:"credentialProvider,omitempty"`
+	HubRoleArn         string `json:"hubRoleArn,omitempty"`
+	HubExternalID      string `json:"hubExternalId,omitempty"`
+	STSEndpoint        string `json:"stsEndpoint,omitempty"`
+}
+
+// ErrUnsupportedVersion is matched (errors.Is) by the *VersionError Decode
+// returns for payloads outside [MinContractVersion, ContractVersion].
+var ErrUnsupportedVersion = errors.New("unsupported job contract version")
+
+// VersionError reports a payload's contract version and the supported range.
+type VersionError struct {
+	Version int
+	RunID   int64 // 0 if the payload didn't carry one
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("%v %d (supported: %d..%d)", ErrUnsupportedVersion, e.Version, MinContractVersion, ContractVersion)
+}
+
+func (e *VersionError) Unwrap() error { return ErrUnsupportedVersion }
+
+// Validate checks the fields every action needs.
+func (j *Job) Validate() error {
+	if j.RunID <= 0 {
+		return errors.New("job: run_id is required")
+	}
+	switch j.Action {
+	case ActionPlan, ActionApply, ActionDestroy, ActionDrift:
+	default:
+		return fmt.Errorf("job: unknown action %q", j.Action)
+	}
+	switch j.Step {
+	case "":
+	case StepPlanForApproval, StepApplyPlan:
+		if j.Action != ActionApply {
+			return fmt.Errorf("job: step %q only applies to %s", j.Step, ActionApply)
+		}
+	default:
+		return fmt.Errorf("job: unknown step %q", j.Step)
+	}
+	if j.BlueprintKey == "" || j.Version == "" {
+		return errors.New("job: blueprint_key and version are required")
+	}
+	if j.AWS.RoleArn == "" {
+		return errors.New("job: aws.roleArn is required")
+	}
+	if j.TimeoutSeconds < 0 {
+		return errors.New("job: timeout_seconds can't be negative")
+	}
+	if j.Attempt < 0 {
+		return errors.New("job: attempt can't be negative")
+	}
+	return nil
+}
+
+// Encode stamps the job with the current contract version, validates it and
+// returns the queue payload.
+func Encode(j Job) ([]byte, error) {
+	j.ContractVersion = ContractVersion
+	if err := j.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(j)
+}
+
+// Decode parses a queue payload. It returns a *VersionError before looking at
+// anything else if the contract version is unsupported. Payloads without a
+// version predate the contract and are read as version 1, whose shape they
+// share.
+func Decode(payload []byte) (*Job, error) {
+	var probe struct {
+		ContractVersion int   `json:"contract_version"`
+		RunID           int64 `json:"run_id"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return nil, fmt.Errorf("job: decode: %w", err)
+	}
+
+	v := probe.ContractVersion
+	if v == 0 {
+		v = 1
+	}
+	if v < MinContractVersion || v > ContractVersion {
+		return nil, &VersionError{Version: v, RunID: probe.RunID}
+	}
+
+	var j Job
+	if err := json.Unmarshal(payload, &j); err != nil {
+		return nil, fmt.Errorf("job: decode: %w", err)
+	}
+	j.ContractVersion = v
+	if err := j.Validate(); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
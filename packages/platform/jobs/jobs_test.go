@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func validJob() Job {
+	return Job{
+		RunID:        42,
+		Action:       ActionApply,
+		Step:         StepPlanForApproval,
+		BlueprintKey: "ecs-service",
+		Version:      "1.0.0",
+		Inputs:       map[string]any{"serviceName": "web", "desiredCount": float64(2)},
+		AWS: AWSTarget{
+			RoleArn:            "arn:aws:iam::123456789012:role/aip",
+			ExternalID:         "ext",
+			Region:             "ap-northeast-1",
+			CredentialProvider: "hub_chain",
+			HubRoleArn:         "arn:aws:iam::210987654321:role/hub",
+		},
+		TimeoutSeconds: 600,
+		EnqueuedAt:     time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		TraceContext:   map[string]string{"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"},
+		RequestID:      "req-1",
+		Attempt:        2,
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	in := validJob()
+	payload, err := Encode(in)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	out, err := Decode(payload)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	in.ContractVersion = ContractVersion
+	if !reflect.DeepEqual(*out, in) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", *out, in)
+	}
+}
+
+func TestEncodeValidates(t *testing.T) {
+	j := validJob()
+	j.Step = StepApplyPlan
+	j.Action = ActionPlan
+	if _, err := Encode(j); err == nil {
+		t.Fatal("Encode accepted a step on a plan job")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		payload     string
+		wantVersion int   // of the decoded job
+		wantErr     bool  // any error
+		versionErr  int   // >0: want a *VersionError with this version...
+		versionRun  int64 // ...and this RunID
+	}{
+		{
+			name:        "missing version reads as v1",
+			payload:     `{"run_id":1,"action":"plan","blueprint_key":"ecs-service","version":"1.0.0","aws":{"roleArn":"arn:aws:iam::123456789012:role/aip"}}`,
+			wantVersion: 1,
+		},
+		{
+			name:        "current version",
+			payload:     `{"contract_version":2,"run_id":1,"action":"apply","step":"apply_plan","blueprint_key":"ecs-service","version":"1.0.0","aws":{"roleArn":"arn:aws:iam::123456789012:role/aip"}}`,
+			wantVersion: 2,
+		},
+		{
+			name:       "version above ContractVersion",
+			payload:    `{"contract_version":99,"run_id":7,"action":"plan"}`,
+			versionErr: 99,
+			versionRun: 7,
+		},
+		{
+			name:       "version below MinContractVersion",
+			payload:    `{"contract_version":-1,"run_id":8}`,
+			versionErr: -1,
+			versionRun: 8,
+		},
+		{
+			name:       "unsupported version without a run",
+			payload:    `{"contract_version":99}`,
+			versionErr: 99,
+		},
+		{
+			name:        "unknown fields are ignored",
+			payload:     `{"contract_version":2,"run_id":1,"action":"destroy","blueprint_key":"ecs-service","version":"1.0.0","aws":{"roleArn":"arn:aws:iam::123456789012:role/aip","future":true},"priority":"high"}`,
+			wantVersion: 2,
+		},
+		{
+			name:    "invalid job",
+			payload: `{"contract_version":2,"run_id":1,"action":"launch","blueprint_key":"ecs-service","version":"1.0.0","aws":{"roleArn":"arn:aws:iam::123456789012:role/aip"}}`,
+			wantErr: true,
+		},
+		{
+			name:    "not JSON",
+			payload: `run 1 please`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := Decode([]byte(tt.payload))
+
+			if tt.versionErr != 0 {
+				var verr *VersionError
+				if !errors.As(err, &verr) {
+					t.Fatalf("err = %v, want a *VersionError", err)
+				}
+				if verr.Version != tt.versionErr || verr.RunID != tt.versionRun {
+					t.Errorf("VersionError = {Version: %d, RunID: %d}, want {%d, %d}", verr.Version, verr.RunID, tt.versionErr, tt.versionRun)
+				}
+				if !errors.Is(err, ErrUnsupportedVersion) {
+					t.Errorf("err doesn't match ErrUnsupportedVersion")
+				}
+				return
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Decode succeeded, want an error")
+				}
+				var verr *VersionError
+				if errors.As(err, &verr) {
+					t.Errorf("err = %v, want a non-version error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if j.ContractVersion != tt.wantVersion {
+				t.Errorf("ContractVersion = %d, want %d", j.ContractVersion, tt.wantVersion)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Package logging sets up structured logging (log/slog) for the API and the
+// worker. Attributes attached to a context with With — the request, caller,
+// deployment and run — are added to every record logged with that context,
+// along with the trace and span IDs of its span, so the lines for one API
+// call or one run can be found together.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Keys of the attributes that correlate log lines.
+const (
+	KeyRequestID    = "request_id"
+	KeyUser         = "user"
+	KeyUserID       = "user_id"
+	KeyOrgID        = "org_id"
+	KeyDeploymentID = "deployment_id"
+	KeyRunID        = "run_id"
+	KeyTraceID      = "trace_id"
+	KeySpanID       = "span_id"
+)
+
+// Setup installs the default logger for serviceName, writing to stderr.
+// LOG_FORMAT is "text" (logfmt, the default) or "json"; LOG_LEVEL is the
+// minimum level logged: debug, info (the default), warn or error. Lines
+// written with the standard log package go through it too, at info level.
+func Setup(serviceName string) (*slog.Logger, error) {
+	logger, err := New(os.Stderr, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
+	if err != nil {
+		return nil, err
+	}
+	logger = logger.With("service", serviceName)
+	slog.SetDefault(logger)
+	return logger, nil
+}
+
+// New returns a logger writing records in format ("text" or "json"; empty
+// means text) at level and above (empty means info).
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: slog.LevelInfo}
+	if level != "" {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+		opts.Level = l
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("LOG_FORMAT: want text or json, got %q", format)
+	}
+	return slog.New(contextHandler{h}), nil
+}
+
+type ctxKey struct{}
+
+// With returns ctx carrying attrs in addition to those it already carries.
+// An attribute replaces one with the same key.
+func With(ctx context.Context, attrs ...slog.Attr) context.Context {
+	prev, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(prev)+len(attrs))
+	for _, a := range prev {
+		if !hasKey(attrs, a.Key) {
+			merged = append(merged, a)
+		}
+	}
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, ctxKey{}, merged)
+}
+
+func hasKey(attrs []slog.Attr, key string) bool {
+	for _, a := range attrs {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// WithRun returns ctx with the lines logged under it attributed to the run.
+func WithRun(ctx context.Context, runID int64) context.Context {
+	return With(ctx, slog.Int64(KeyRunID, runID))
+}
+
+// WithDeployment returns ctx with the lines logged under it attributed to
+// the deployment.
+func WithDeployment(ctx context.Context, deploymentID int64) context.Context {
+	return With(ctx, slog.Int64(KeyDeploymentID, deploymentID))
+}
+
+// RequestID returns the ID of the API request ctx was derived from, or "".
+func RequestID(ctx context.Context) string {
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	for _, a := range attrs {
+		if a.Key == KeyRequestID {
+			return a.Value.String()
+		}
+	}
+	return ""
+}
+
+// Err is the attribute errors are logged under.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// contextHandler adds the attributes carried by the context and the current
+// span's IDs to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(ctxKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String(KeyTraceID, sc.TraceID().String()),
+			slog.String(KeySpanID, sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,82 @@
+// Package tracing sets up OpenTelemetry tracing for the API and the worker,
+// and carries trace context across the job queue so a run's trace spans from
+// the request that started it to the terraform commands that executed it.
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/your-org/aws-infra-platform/packages/platform/jobs"
+)
+
+// Setup installs the global tracer provider and W3C trace context
+// propagation. Spans are exported over OTLP/HTTP when an endpoint is
+// configured (OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, e.g. http://localhost:4318 for a local
+// collector); otherwise no spans are recorded, but trace context received
+// from callers is still passed on. OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES override serviceName and add attributes.
+//
+// The returned function flushes pending spans; call it on shutdown.
+func Setup(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Later options win, so the environment overrides serviceName
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer for spans created by the named component.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("github.com/your-org/aws-infra-platform/" + name)
+}
+
+// InjectJob records the span context of ctx on the job, so the worker can
+// continue the trace.
+func InjectJob(ctx context.Context, job *jobs.Job) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		job.TraceContext = carrier
+	}
+}
+
+// ExtractJob returns ctx carrying the span context the job was enqueued
+// with, if any.
+func ExtractJob(ctx context.Context, job *jobs.Job) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(job.TraceContext))
+}